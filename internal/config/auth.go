@@ -5,36 +5,172 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 )
 
 const (
+	vaultAuthMethod      = "VAULT_AUTH_METHOD" // Optional, defaults to aws
 	vaultAuthRole        = "VAULT_AUTH_ROLE"
 	vaultAuthProvider    = "VAULT_AUTH_PROVIDER"
-	vaultAssumedRoleArn  = "VAULT_ASSUMED_ROLE_ARN"    // Optional
+	vaultAssumedRoleArn  = "VAULT_ASSUMED_ROLE_ARN"    // Optional, comma-separated to chain roles
 	vaultIAMServerID     = "VAULT_IAM_SERVER_ID"       // Optional
 	vleVaultAddr         = "VLE_VAULT_ADDR"            // Optional, overrides VAULT_ADDR
 	stsEndpointRegionEnv = "VAULT_STS_ENDPOINT_REGION" // Optional
+	vleVaultClientCert   = "VLE_VAULT_CLIENT_CERT"     // Optional, overrides VAULT_CLIENT_CERT
+	vleVaultClientKey    = "VLE_VAULT_CLIENT_KEY"      // Optional, overrides VAULT_CLIENT_KEY
+	vaultClientCert      = "VAULT_CLIENT_CERT"         // Optional
+	vaultClientKey       = "VAULT_CLIENT_KEY"          // Optional
+
+	vaultAssumedRoleExternalID  = "VAULT_ASSUMED_ROLE_EXTERNAL_ID"  // Optional
+	vaultAssumedRoleSessionName = "VAULT_ASSUMED_ROLE_SESSION_NAME" // Optional
+	vaultAssumedRoleSessionTags = "VAULT_ASSUMED_ROLE_SESSION_TAGS" // Optional
+
+	vaultAppRoleRoleID          = "VAULT_APPROLE_ROLE_ID"
+	vaultAppRoleSecretID        = "VAULT_APPROLE_SECRET_ID"         // Optional
+	vaultAppRoleSecretIDFile    = "VAULT_APPROLE_SECRET_ID_FILE"    // Optional
+	vaultAppRoleWrappedSecretID = "VAULT_APPROLE_WRAPPED_SECRET_ID" // Optional
+
+	vaultJWT     = "VAULT_JWT"      // Optional
+	vaultJWTFile = "VAULT_JWT_FILE" // Optional
+
+	vaultToken     = "VAULT_TOKEN"      // Optional
+	vaultTokenFile = "VAULT_TOKEN_FILE" // Optional, takes precedence over VAULT_TOKEN
+
+	vaultAuthNamespace    = "VAULT_AUTH_NAMESPACE"    // Optional, defaults to VAULT_NAMESPACE
+	vaultSecretsNamespace = "VAULT_SECRETS_NAMESPACE" // Optional, overrides VAULT_NAMESPACE
+
+	vaultRevokeTokenOnShutdown = "VAULT_REVOKE_TOKEN_ON_SHUTDOWN" // Optional, defaults to false
+
+	awsLambdaFunctionName = "AWS_LAMBDA_FUNCTION_NAME" // Set by Lambda
+
+	// AuthMethodAWS authenticates with the AWS IAM auth method, using the
+	// function's execution role.
+	AuthMethodAWS = "aws"
+
+	// AuthMethodAppRole authenticates with the AppRole auth method.
+	AuthMethodAppRole = "approle"
+
+	// AuthMethodJWT authenticates with the JWT/OIDC auth method, using a JWT
+	// from the environment or a file.
+	AuthMethodJWT = "jwt"
+
+	// AuthMethodCert authenticates with the TLS certificate auth method, using
+	// the client certificate presented on every request to Vault.
+	AuthMethodCert = "cert"
+
+	// AuthMethodToken uses an existing token from the environment or a file,
+	// for local development and break-glass access.
+	AuthMethodToken = "token"
 )
 
 // AuthConfig holds config required for logging in to Vault.
 type AuthConfig struct {
+	Method            string
 	Role              string
 	Provider          string
 	AssumedRoleArn    string
+	ExternalID        string
+	SessionName       string
+	SessionTags       string
 	IAMServerID       string
 	STSEndpointRegion string
 	VaultAddress      string
+	FunctionName      string // Set by Lambda in the extension's environment
+	ClientCert        string
+	ClientKey         string
+
+	AppRoleRoleID          string
+	AppRoleSecretID        string
+	AppRoleSecretIDFile    string
+	AppRoleWrappedSecretID string
+
+	JWT     string
+	JWTFile string
+
+	Token     string
+	TokenFile string
+
+	// Namespace is the Vault Enterprise namespace used to log in and renew
+	// the token. SecretsNamespace is used to read secrets in file mode, and is
+	// added to proxied requests. If either is empty, the namespace from
+	// VAULT_NAMESPACE is used instead, except for proxied requests, which are
+	// forwarded without a namespace.
+	Namespace        string
+	SecretsNamespace string
+
+	// RevokeOnShutdown revokes the extension's token when the execution
+	// environment shuts down.
+	RevokeOnShutdown bool
 }
 
 // AuthConfigFromEnv reads config from the environment for authenticating to Vault.
 func AuthConfigFromEnv() AuthConfig {
+	method := strings.ToLower(strings.TrimSpace(os.Getenv(vaultAuthMethod)))
+	if method == "" {
+		method = AuthMethodAWS
+	}
+
 	return AuthConfig{
+		Method:            method,
 		Role:              strings.TrimSpace(os.Getenv(vaultAuthRole)),
 		Provider:          strings.TrimSpace(os.Getenv(vaultAuthProvider)),
 		AssumedRoleArn:    strings.TrimSpace(os.Getenv(vaultAssumedRoleArn)),
+		ExternalID:        strings.TrimSpace(os.Getenv(vaultAssumedRoleExternalID)),
+		SessionName:       strings.TrimSpace(os.Getenv(vaultAssumedRoleSessionName)),
+		SessionTags:       strings.TrimSpace(os.Getenv(vaultAssumedRoleSessionTags)),
 		IAMServerID:       strings.TrimSpace(os.Getenv(vaultIAMServerID)),
 		STSEndpointRegion: strings.TrimSpace(os.Getenv(stsEndpointRegionEnv)),
 		VaultAddress:      strings.TrimSpace(os.Getenv(vleVaultAddr)),
+		FunctionName:      os.Getenv(awsLambdaFunctionName),
+		ClientCert:        getenvWithOverride(vleVaultClientCert, vaultClientCert),
+		ClientKey:         getenvWithOverride(vleVaultClientKey, vaultClientKey),
+
+		AppRoleRoleID:          strings.TrimSpace(os.Getenv(vaultAppRoleRoleID)),
+		AppRoleSecretID:        strings.TrimSpace(os.Getenv(vaultAppRoleSecretID)),
+		AppRoleSecretIDFile:    strings.TrimSpace(os.Getenv(vaultAppRoleSecretIDFile)),
+		AppRoleWrappedSecretID: strings.TrimSpace(os.Getenv(vaultAppRoleWrappedSecretID)),
+
+		JWT:     strings.TrimSpace(os.Getenv(vaultJWT)),
+		JWTFile: strings.TrimSpace(os.Getenv(vaultJWTFile)),
+
+		Token:     strings.TrimSpace(os.Getenv(vaultToken)),
+		TokenFile: strings.TrimSpace(os.Getenv(vaultTokenFile)),
+
+		Namespace:        strings.Trim(strings.TrimSpace(os.Getenv(vaultAuthNamespace)), "/"),
+		SecretsNamespace: strings.Trim(strings.TrimSpace(os.Getenv(vaultSecretsNamespace)), "/"),
+
+		RevokeOnShutdown: getenvBool(vaultRevokeTokenOnShutdown),
+	}
+}
+
+// getenvBool parses a boolean environment variable, treating unset or invalid
+// values as false.
+func getenvBool(name string) bool {
+	b, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(name)))
+	if err != nil {
+		return false
 	}
+
+	return b
+}
+
+// getenvWithOverride returns the value of the extension-specific override
+// variable if it is set, and otherwise the value of the standard variable.
+func getenvWithOverride(override, standard string) string {
+	if v := strings.TrimSpace(os.Getenv(override)); v != "" {
+		return v
+	}
+
+	return strings.TrimSpace(os.Getenv(standard))
+}
+
+// Mount returns the path the auth method is mounted at, which is set with
+// VAULT_AUTH_PROVIDER and defaults to the name of the method.
+func (c AuthConfig) Mount() string {
+	if c.Provider != "" {
+		return strings.Trim(c.Provider, "/")
+	}
+
+	return c.Method
 }
@@ -19,12 +19,19 @@ const (
 	// from cache, making caching "opt-out" instead of "opt-in". Caching may
 	// still be disabled per-request with the "nocache" cache-control header.
 	VaultCacheEnabled = "VAULT_DEFAULT_CACHE_ENABLED"
+
+	// The largest response body, in bytes, saved in the cache. Larger
+	// responses are still returned, but not cached.
+	VaultCacheMaxEntrySize = "VAULT_CACHE_MAX_ENTRY_SIZE"
+
+	DefaultCacheMaxEntrySize = 1 << 20
 )
 
 // CacheConfig holds config for the request cache
 type CacheConfig struct {
 	TTL            time.Duration
 	DefaultEnabled bool
+	MaxEntrySize   int64
 }
 
 // CacheConfigFromEnv reads config from the environment for caching
@@ -49,8 +56,18 @@ func CacheConfigFromEnv() CacheConfig {
 		}
 	}
 
+	maxEntrySize := int64(DefaultCacheMaxEntrySize)
+	maxEntrySizeEnv := strings.TrimSpace(os.Getenv(VaultCacheMaxEntrySize))
+	if maxEntrySizeEnv != "" {
+		size, err := strconv.ParseInt(maxEntrySizeEnv, 10, 64)
+		if err == nil && size > 0 {
+			maxEntrySize = size
+		}
+	}
+
 	return CacheConfig{
 		TTL:            cacheTTL,
 		DefaultEnabled: defaultOn,
+		MaxEntrySize:   maxEntrySize,
 	}
 }
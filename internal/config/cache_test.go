@@ -59,4 +59,22 @@ func TestCacheConfig(t *testing.T) {
 			assert.False(t, cacheConfig.DefaultEnabled)
 		}
 	})
+
+	t.Run("Default max entry size", func(t *testing.T) {
+		assert.Equal(t, int64(DefaultCacheMaxEntrySize), CacheConfigFromEnv().MaxEntrySize)
+	})
+
+	t.Run("Valid max entry size", func(t *testing.T) {
+		defer os.Unsetenv(VaultCacheMaxEntrySize)
+		os.Setenv(VaultCacheMaxEntrySize, "4096")
+		assert.Equal(t, int64(4096), CacheConfigFromEnv().MaxEntrySize)
+	})
+
+	t.Run("Invalid max entry size falls back to the default", func(t *testing.T) {
+		defer os.Unsetenv(VaultCacheMaxEntrySize)
+		for _, size := range []string{"0", "-1", "1MB", "foo"} {
+			os.Setenv(VaultCacheMaxEntrySize, size)
+			assert.Equal(t, int64(DefaultCacheMaxEntrySize), CacheConfigFromEnv().MaxEntrySize, size)
+		}
+	})
 }
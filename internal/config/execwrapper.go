@@ -0,0 +1,40 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// The maximum time the exec wrapper waits for the extension to write the
+	// secret files it reads environment variables from, e.g. "10s".
+	VaultExecWrapperTimeout = "VAULT_EXEC_WRAPPER_TIMEOUT"
+
+	DefaultExecWrapperTimeout = 10 * time.Second
+)
+
+// ExecWrapperConfig holds config for the exec wrapper.
+type ExecWrapperConfig struct {
+	Timeout time.Duration
+}
+
+// ExecWrapperConfigFromEnv reads config from the environment for the exec
+// wrapper.
+func ExecWrapperConfigFromEnv() ExecWrapperConfig {
+	timeout := DefaultExecWrapperTimeout
+	timeoutEnv := strings.TrimSpace(os.Getenv(VaultExecWrapperTimeout))
+	if timeoutEnv != "" {
+		d, err := time.ParseDuration(timeoutEnv)
+		if err == nil && d > 0 {
+			timeout = d
+		}
+	}
+
+	return ExecWrapperConfig{
+		Timeout: timeout,
+	}
+}
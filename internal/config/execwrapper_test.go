@@ -0,0 +1,32 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecWrapperConfig(t *testing.T) {
+	t.Run("Default timeout", func(t *testing.T) {
+		assert.Equal(t, DefaultExecWrapperTimeout, ExecWrapperConfigFromEnv().Timeout)
+	})
+
+	t.Run("Valid timeout", func(t *testing.T) {
+		defer os.Unsetenv(VaultExecWrapperTimeout)
+		os.Setenv(VaultExecWrapperTimeout, "2s")
+		assert.Equal(t, 2*time.Second, ExecWrapperConfigFromEnv().Timeout)
+	})
+
+	t.Run("Invalid timeout falls back to the default", func(t *testing.T) {
+		defer os.Unsetenv(VaultExecWrapperTimeout)
+		for _, d := range []string{"0", "-1s", "10"} {
+			os.Setenv(VaultExecWrapperTimeout, d)
+			assert.Equal(t, DefaultExecWrapperTimeout, ExecWrapperConfigFromEnv().Timeout, d)
+		}
+	})
+}
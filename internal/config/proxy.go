@@ -0,0 +1,193 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The address the proxy server listens on, either host:port or
+	// unix:///path/to/socket.
+	VaultProxyListen = "VAULT_PROXY_LISTEN"
+
+	// The octal file permissions of the proxy's Unix domain socket.
+	VaultProxySocketMode = "VAULT_PROXY_SOCKET_MODE"
+
+	// Comma-separated path patterns the proxy allows or denies requests to.
+	// Each is optionally followed by a colon and a |-separated list of
+	// methods, e.g. "secret/data/app/*:GET|LIST". If any allow rules are set,
+	// requests must match one of them, and deny rules take precedence.
+	VaultProxyAllow = "VAULT_PROXY_ALLOW"
+	VaultProxyDeny  = "VAULT_PROXY_DENY"
+
+	// Unless set to `false`, the proxy also denies requests to create tokens
+	// and to sys/ endpoints.
+	VaultProxyDenyDefaults = "VAULT_PROXY_DENY_DEFAULTS"
+
+	DefaultProxyListen     = "127.0.0.1:8200"
+	DefaultProxySocketMode = os.FileMode(0600)
+
+	unixSocketPrefix = "unix://"
+)
+
+// DefaultProxyDenyRules are added to the deny rules unless
+// VAULT_PROXY_DENY_DEFAULTS is false. They match in the namespace a request
+// is sent to, the secrets namespace or the client's namespace, including in
+// child namespaces of those given at the start of the path.
+var DefaultProxyDenyRules = []ProxyRule{
+	{Pattern: "auth/token/create*", AnyNamespace: true},
+	{Pattern: "sys/*", AnyNamespace: true},
+}
+
+// proxyRuleMethods are the methods a proxy rule can be limited to.
+var proxyRuleMethods = map[string]struct{}{
+	"GET":    {},
+	"LIST":   {},
+	"POST":   {},
+	"PUT":    {},
+	"PATCH":  {},
+	"DELETE": {},
+}
+
+// ProxyConfig holds config for the proxy server.
+type ProxyConfig struct {
+	// Network is "tcp" or "unix", and Address is a host:port or the path to
+	// a Unix domain socket, as passed to net.Listen.
+	Network    string
+	Address    string
+	SocketMode os.FileMode
+
+	Allow []ProxyRule
+	Deny  []ProxyRule
+}
+
+// ProxyRule matches requests to Vault paths, without the /v1/ prefix, that
+// match a glob pattern where * matches any characters. If Methods is empty,
+// the rule matches all methods. If AnyNamespace is set, the rule also matches
+// the path within a known namespace with any leading segments removed, as only
+// Vault knows which of them are child namespaces.
+type ProxyRule struct {
+	Pattern      string
+	Methods      []string
+	AnyNamespace bool
+}
+
+// String returns the rule in the format it is configured in, e.g.
+// "secret/data/app/*:GET|LIST".
+func (r ProxyRule) String() string {
+	if len(r.Methods) == 0 {
+		return r.Pattern
+	}
+
+	return r.Pattern + ":" + strings.Join(r.Methods, "|")
+}
+
+// ProxyConfigFromEnv reads config from the environment for the proxy server.
+// Unlike most config, invalid values are an error, as the function would
+// otherwise be unable to reach the proxy, or the proxy would allow requests it
+// was meant to deny.
+func ProxyConfigFromEnv() (ProxyConfig, error) {
+	cfg := ProxyConfig{
+		Network:    "tcp",
+		Address:    DefaultProxyListen,
+		SocketMode: DefaultProxySocketMode,
+	}
+
+	if listen := strings.TrimSpace(os.Getenv(VaultProxyListen)); listen != "" {
+		if path, ok := strings.CutPrefix(listen, unixSocketPrefix); ok {
+			if !filepath.IsAbs(path) {
+				return ProxyConfig{}, fmt.Errorf("invalid %s %q: Unix socket must be an absolute path, e.g. unix:///tmp/vault.sock", VaultProxyListen, listen)
+			}
+			cfg.Network = "unix"
+			cfg.Address = filepath.Clean(path)
+		} else {
+			host, port, err := net.SplitHostPort(listen)
+			if err != nil {
+				return ProxyConfig{}, fmt.Errorf("invalid %s %q: must be host:port or unix:///path: %w", VaultProxyListen, listen, err)
+			}
+			p, err := strconv.ParseUint(port, 10, 16)
+			if host == "" || err != nil || p == 0 {
+				return ProxyConfig{}, fmt.Errorf("invalid %s %q: must be host:port with a port between 1 and 65535, or unix:///path", VaultProxyListen, listen)
+			}
+			cfg.Address = listen
+		}
+	}
+
+	if modeEnv := strings.TrimSpace(os.Getenv(VaultProxySocketMode)); modeEnv != "" {
+		mode, err := strconv.ParseUint(modeEnv, 8, 32)
+		if err != nil || mode == 0 || mode > 0777 {
+			return ProxyConfig{}, fmt.Errorf("invalid %s %q: must be an octal permission between 0001 and 0777", VaultProxySocketMode, modeEnv)
+		}
+		cfg.SocketMode = os.FileMode(mode)
+	}
+
+	var err error
+	cfg.Allow, err = parseProxyRules(VaultProxyAllow)
+	if err != nil {
+		return ProxyConfig{}, err
+	}
+	cfg.Deny, err = parseProxyRules(VaultProxyDeny)
+	if err != nil {
+		return ProxyConfig{}, err
+	}
+	denyDefaults := true
+	if denyDefaultsEnv := strings.TrimSpace(os.Getenv(VaultProxyDenyDefaults)); denyDefaultsEnv != "" {
+		denyDefaults, err = strconv.ParseBool(denyDefaultsEnv)
+		if err != nil {
+			return ProxyConfig{}, fmt.Errorf("invalid %s %q: must be true or false", VaultProxyDenyDefaults, denyDefaultsEnv)
+		}
+	}
+	if denyDefaults {
+		cfg.Deny = append(cfg.Deny, DefaultProxyDenyRules...)
+	}
+
+	return cfg, nil
+}
+
+// parseProxyRules parses the comma-separated rules in the named environment
+// variable.
+func parseProxyRules(name string) ([]ProxyRule, error) {
+	var rules []ProxyRule
+	for _, r := range strings.Split(os.Getenv(name), ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		var rule ProxyRule
+		pattern, methods, hasMethods := strings.Cut(r, ":")
+		pattern = strings.TrimPrefix(strings.TrimLeft(strings.TrimSpace(pattern), "/"), "v1/")
+		if pattern == "" {
+			return nil, fmt.Errorf("invalid rule %q in %s: missing path pattern", r, name)
+		}
+		rule.Pattern = pattern
+		if hasMethods {
+			for _, m := range strings.Split(methods, "|") {
+				m = strings.ToUpper(strings.TrimSpace(m))
+				if _, ok := proxyRuleMethods[m]; !ok {
+					return nil, fmt.Errorf("invalid rule %q in %s: unknown method %q; must be one of GET, LIST, POST, PUT, PATCH or DELETE", r, name, m)
+				}
+				rule.Methods = append(rule.Methods, m)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// URL returns the address function code should use to reach the proxy.
+func (c ProxyConfig) URL() string {
+	if c.Network == "unix" {
+		return unixSocketPrefix + c.Address
+	}
+
+	return "http://" + c.Address
+}
@@ -0,0 +1,128 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyConfig(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := ProxyConfigFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, ProxyConfig{Network: "tcp", Address: "127.0.0.1:8200", SocketMode: 0600, Deny: DefaultProxyDenyRules}, cfg)
+		assert.Equal(t, "http://127.0.0.1:8200", cfg.URL())
+	})
+
+	for name, tc := range map[string]struct {
+		listen   string
+		mode     string
+		expected ProxyConfig
+	}{
+		"host and port": {
+			listen:   "127.0.0.1:8300",
+			expected: ProxyConfig{Network: "tcp", Address: "127.0.0.1:8300", SocketMode: 0600, Deny: DefaultProxyDenyRules},
+		},
+		"hostname": {
+			listen:   "localhost:9000",
+			expected: ProxyConfig{Network: "tcp", Address: "localhost:9000", SocketMode: 0600, Deny: DefaultProxyDenyRules},
+		},
+		"IPv6": {
+			listen:   "[::1]:8200",
+			expected: ProxyConfig{Network: "tcp", Address: "[::1]:8200", SocketMode: 0600, Deny: DefaultProxyDenyRules},
+		},
+		"Unix socket": {
+			listen:   "unix:///tmp/vault.sock",
+			expected: ProxyConfig{Network: "unix", Address: "/tmp/vault.sock", SocketMode: 0600, Deny: DefaultProxyDenyRules},
+		},
+		"Unix socket with mode": {
+			listen:   "unix:///tmp/vault.sock",
+			mode:     "0660",
+			expected: ProxyConfig{Network: "unix", Address: "/tmp/vault.sock", SocketMode: 0660, Deny: DefaultProxyDenyRules},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(VaultProxyListen, tc.listen)
+			t.Setenv(VaultProxySocketMode, tc.mode)
+			cfg, err := ProxyConfigFromEnv()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, cfg)
+		})
+	}
+
+	for name, tc := range map[string]struct {
+		listen string
+		mode   string
+	}{
+		"no port":              {listen: "127.0.0.1"},
+		"no host":              {listen: ":8200"},
+		"port zero":            {listen: "127.0.0.1:0"},
+		"port out of range":    {listen: "127.0.0.1:70000"},
+		"named port":           {listen: "127.0.0.1:http"},
+		"relative Unix socket": {listen: "unix://vault.sock"},
+		"empty Unix socket":    {listen: "unix://"},
+		"invalid mode":         {mode: "rw"},
+		"decimal mode":         {mode: "999"},
+		"zero mode":            {mode: "0"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(VaultProxyListen, tc.listen)
+			t.Setenv(VaultProxySocketMode, tc.mode)
+			_, err := ProxyConfigFromEnv()
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestProxyConfig_Rules(t *testing.T) {
+	t.Run("No rules", func(t *testing.T) {
+		cfg, err := ProxyConfigFromEnv()
+		require.NoError(t, err)
+		assert.Empty(t, cfg.Allow)
+		assert.Equal(t, DefaultProxyDenyRules, cfg.Deny)
+	})
+
+	t.Run("Valid rules", func(t *testing.T) {
+		t.Setenv(VaultProxyAllow, " secret/data/app/*:get|list , /v1/database/creds/app ,")
+		t.Setenv(VaultProxyDeny, "secret/data/app/admin:DELETE")
+		t.Setenv(VaultProxyDenyDefaults, "false")
+		cfg, err := ProxyConfigFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, []ProxyRule{
+			{Pattern: "secret/data/app/*", Methods: []string{"GET", "LIST"}},
+			{Pattern: "database/creds/app"},
+		}, cfg.Allow)
+		assert.Equal(t, []ProxyRule{
+			{Pattern: "secret/data/app/admin", Methods: []string{"DELETE"}},
+		}, cfg.Deny)
+	})
+
+	t.Run("Default deny rules", func(t *testing.T) {
+		t.Setenv(VaultProxyDeny, "secret/*:DELETE")
+		cfg, err := ProxyConfigFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, append([]ProxyRule{{Pattern: "secret/*", Methods: []string{"DELETE"}}}, DefaultProxyDenyRules...), cfg.Deny)
+	})
+
+	t.Run("Invalid deny defaults", func(t *testing.T) {
+		t.Setenv(VaultProxyDenyDefaults, "sometimes")
+		_, err := ProxyConfigFromEnv()
+		require.Error(t, err)
+	})
+
+	for name, rules := range map[string]string{
+		"missing pattern": ":GET",
+		"unknown method":  "secret/*:READ",
+		"empty method":    "secret/*:GET|",
+	} {
+		t.Run("Invalid "+name, func(t *testing.T) {
+			t.Setenv(VaultProxyAllow, rules)
+			_, err := ProxyConfigFromEnv()
+			require.Error(t, err)
+		})
+	}
+}
@@ -4,28 +4,47 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/hashicorp/go-multierror"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/render"
 )
 
 const (
-	vaultSecretPathKey    = "VAULT_SECRET_PATH"
-	vaultSecretFileKey    = "VAULT_SECRET_FILE"
-	vaultSecretPathPrefix = vaultSecretPathKey + "_"
-	vaultSecretFilePrefix = vaultSecretFileKey + "_"
+	vaultSecretPathKey     = "VAULT_SECRET_PATH"
+	vaultSecretFileKey     = "VAULT_SECRET_FILE"
+	vaultSecretTemplateKey = "VAULT_SECRET_TEMPLATE"
+	vaultSecretFormatKey   = "VAULT_SECRET_FORMAT"
+	vaultSecretModeKey     = "VAULT_SECRET_MODE"
+	vaultSecretMethodKey   = "VAULT_SECRET_METHOD"
+	vaultSecretDataKey     = "VAULT_SECRET_DATA"
+	vaultSecretEnvKey      = "VAULT_SECRET_ENV"
+
+	// templateFilePrefix marks a template setting as a path to a file holding
+	// the template, following the Vault CLI's "@file" convention.
+	templateFilePrefix = "@"
 
 	DefaultSecretDirectory = "/tmp/vault"
 	DefaultSecretFile      = "secret.json"
 )
 
+var envVarNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 var (
 	// For the purposes of mocking in tests
-	getenv  = os.Getenv
-	environ = os.Environ
+	getenv   = os.Getenv
+	environ  = os.Environ
+	readFile = os.ReadFile
 )
 
 // ConfiguredSecret represents a pair of environment variables of the form:
@@ -35,11 +54,37 @@ var (
 //
 // Where FOO is the name, and must match across both env vars to form a
 // valid secret configuration. The name can also be empty.
+//
+// Optionally, VAULT_SECRET_TEMPLATE_FOO can hold a Go text/template that is
+// rendered with the secret to produce the file's content. If the value starts
+// with "@", the rest of the value is the path to a file holding the template.
+// Alternatively, VAULT_SECRET_FORMAT_FOO selects one of the built-in formats.
+// VAULT_SECRET_MODE_FOO sets the file's permissions as an octal number.
+//
+// Secrets engines that only issue secrets on a write, such as pki/issue/<role>,
+// can be used by setting VAULT_SECRET_METHOD_FOO=POST, with the request body
+// given as a JSON object in VAULT_SECRET_DATA_FOO.
+//
+// For the exec wrapper, VAULT_SECRET_ENV_FOO=DB_USER=data.username,... maps
+// fields of the written file to environment variables for the runtime.
 type ConfiguredSecret struct {
 	name string // The name assigned to the secret
 
-	VaultPath string // The path to read from in Vault
-	FilePath  string // The path to write to in the file system
+	VaultPath string                 // The path to read from in Vault
+	FilePath  string                 // The path to write to in the file system
+	Template  *template.Template     // Optional template to render the secret with
+	Format    render.Format          // Optional format to write the secret in, defaults to JSON
+	Mode      os.FileMode            // Optional file permissions, defaults to 0600
+	Method    string                 // Optional HTTP method, GET (the default), POST or PUT
+	Data      map[string]interface{} // Optional request data for POST or PUT
+	Env       []EnvVar               // Optional environment variables for the exec wrapper
+}
+
+// EnvVar maps a field of a secret's file, given as a dot-separated path, to
+// an environment variable.
+type EnvVar struct {
+	Name  string
+	Field string
 }
 
 // Valid checks that both a secret path and a destination path are given.
@@ -47,6 +92,12 @@ func (cs ConfiguredSecret) Valid() bool {
 	return cs.VaultPath != "" && cs.FilePath != ""
 }
 
+// IsWrite returns true if the secret is generated by writing to Vault rather
+// than reading from it.
+func (cs ConfiguredSecret) IsWrite() bool {
+	return cs.Method == http.MethodPost || cs.Method == http.MethodPut
+}
+
 // Name is the name parsed from the environment variable name. This name is used
 // as a key to match secrets with file paths.
 func (cs ConfiguredSecret) Name() string {
@@ -57,6 +108,99 @@ func (cs ConfiguredSecret) Name() string {
 	return cs.name
 }
 
+// secretSetting is a per-secret environment variable, which is suffixed with
+// "_<NAME>" for named secrets.
+type secretSetting struct {
+	key   string
+	apply func(s *ConfiguredSecret, value string) error
+}
+
+var secretSettings = []secretSetting{
+	{
+		key: vaultSecretPathKey,
+		apply: func(s *ConfiguredSecret, value string) error {
+			s.VaultPath = strings.TrimSpace(value)
+			return nil
+		},
+	},
+	{
+		key: vaultSecretFileKey,
+		apply: func(s *ConfiguredSecret, value string) error {
+			s.FilePath = filePathFromEnv(strings.TrimSpace(value))
+			return nil
+		},
+	},
+	{
+		key: vaultSecretTemplateKey,
+		apply: func(s *ConfiguredSecret, value string) error {
+			// Whitespace is significant in an inline template, so use the
+			// untrimmed value.
+			tmpl, err := parseTemplate(s.name, value)
+			if err != nil {
+				return err
+			}
+			s.Template = tmpl
+			return nil
+		},
+	},
+	{
+		key: vaultSecretFormatKey,
+		apply: func(s *ConfiguredSecret, value string) error {
+			format, err := render.ParseFormat(value)
+			if err != nil {
+				return fmt.Errorf("invalid format for secret %s: %w", s.Name(), err)
+			}
+			s.Format = format
+			return nil
+		},
+	},
+	{
+		key: vaultSecretModeKey,
+		apply: func(s *ConfiguredSecret, value string) error {
+			mode, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+			if err != nil || mode == 0 || mode > 0777 {
+				return fmt.Errorf("invalid file mode %q for secret %s: must be an octal permission between 0001 and 0777", strings.TrimSpace(value), s.Name())
+			}
+			s.Mode = os.FileMode(mode)
+			return nil
+		},
+	},
+	{
+		key: vaultSecretMethodKey,
+		apply: func(s *ConfiguredSecret, value string) error {
+			method := strings.ToUpper(strings.TrimSpace(value))
+			switch method {
+			case http.MethodGet, http.MethodPost, http.MethodPut:
+				s.Method = method
+				return nil
+			}
+			return fmt.Errorf("invalid method %q for secret %s: must be one of GET, POST or PUT", strings.TrimSpace(value), s.Name())
+		},
+	},
+	{
+		key: vaultSecretDataKey,
+		apply: func(s *ConfiguredSecret, value string) error {
+			var data map[string]interface{}
+			if err := json.Unmarshal([]byte(value), &data); err != nil {
+				return fmt.Errorf("invalid request data for secret %s: must be a JSON object: %w", s.Name(), err)
+			}
+			s.Data = data
+			return nil
+		},
+	},
+	{
+		key: vaultSecretEnvKey,
+		apply: func(s *ConfiguredSecret, value string) error {
+			env, err := parseEnvVars(value)
+			if err != nil {
+				return fmt.Errorf("invalid environment variables for secret %s: %w", s.Name(), err)
+			}
+			s.Env = env
+			return nil
+		},
+	},
+}
+
 // ParseConfiguredSecrets reads environment variables to determine which secrets
 // to read from Vault, and where to write them on disk.
 func ParseConfiguredSecrets() ([]ConfiguredSecret, error) {
@@ -71,39 +215,26 @@ func ParseConfiguredSecrets() ([]ConfiguredSecret, error) {
 			return nil, fmt.Errorf("os.Environ should return key=value pairs, but got %s", kv)
 		}
 		key := parts[0]
-		value := strings.TrimSpace(parts[1])
 
-		switch {
-		case strings.HasPrefix(key, vaultSecretPathPrefix):
-			name := key[len(vaultSecretPathPrefix):]
-			if name == "" {
-				resultErr = multierror.Append(resultErr, fmt.Errorf("%s is not valid configuration; specify %s for a nameless secret or specify a non-zero length name", vaultSecretPathPrefix, vaultSecretPathKey))
-				break
+		for _, setting := range secretSettings {
+			prefix := setting.key + "_"
+			if !strings.HasPrefix(key, prefix) {
+				continue
 			}
-			if s, exists := secrets[name]; exists {
-				s.VaultPath = value
-			} else {
-				secrets[name] = &ConfiguredSecret{
-					name:      name,
-					VaultPath: value,
-				}
-			}
-
-		case strings.HasPrefix(key, vaultSecretFilePrefix):
-			name := key[len(vaultSecretFilePrefix):]
+			name := key[len(prefix):]
 			if name == "" {
-				resultErr = multierror.Append(resultErr, fmt.Errorf("%s is not valid configuration; specify %s for a nameless secret or specify a non-zero length name", vaultSecretFilePrefix, vaultSecretFileKey))
+				resultErr = multierror.Append(resultErr, fmt.Errorf("%s is not valid configuration; specify %s for a nameless secret or specify a non-zero length name", prefix, setting.key))
 				break
 			}
-			filePath := filePathFromEnv(value)
-			if s, exists := secrets[name]; exists {
-				s.FilePath = filePath
-			} else {
-				secrets[name] = &ConfiguredSecret{
-					name:     name,
-					FilePath: filePath,
-				}
+			s, exists := secrets[name]
+			if !exists {
+				s = &ConfiguredSecret{name: name}
+				secrets[name] = s
 			}
+			if err := setting.apply(s, parts[1]); err != nil {
+				resultErr = multierror.Append(resultErr, err)
+			}
+			break
 		}
 	}
 
@@ -111,9 +242,16 @@ func ParseConfiguredSecrets() ([]ConfiguredSecret, error) {
 	anonymousSecretVaultPath := strings.TrimSpace(getenv(vaultSecretPathKey))
 	if anonymousSecretVaultPath != "" {
 		s := &ConfiguredSecret{
-			name:      "",
-			VaultPath: anonymousSecretVaultPath,
-			FilePath:  filePathFromEnv(strings.TrimSpace(getenv(vaultSecretFileKey))),
+			name: "",
+		}
+		for _, setting := range secretSettings {
+			value := getenv(setting.key)
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+			if err := setting.apply(s, value); err != nil {
+				resultErr = multierror.Append(resultErr, err)
+			}
 		}
 		if s.FilePath == "" {
 			s.FilePath = path.Join(DefaultSecretDirectory, DefaultSecretFile)
@@ -121,18 +259,43 @@ func ParseConfiguredSecrets() ([]ConfiguredSecret, error) {
 		secrets[""] = s
 	}
 
-	// Track files we will write to check for clashes.
+	// Track files we will write and environment variables we will set to
+	// check for clashes.
 	fileLocations := make(map[string]*ConfiguredSecret)
+	envNames := make(map[string]*ConfiguredSecret)
 	result := make([]ConfiguredSecret, 0)
 	for _, secret := range secrets {
 		if !secret.Valid() {
 			resultErr = multierror.Append(resultErr, fmt.Errorf("invalid secret (must have both a path and a file specified): path=%q, file=%q", secret.VaultPath, secret.FilePath))
 			continue
 		}
+		if secret.Data != nil && !secret.IsWrite() {
+			resultErr = multierror.Append(resultErr, fmt.Errorf("secret %s has request data configured, which requires the POST or PUT method", secret.Name()))
+			continue
+		}
+		if secret.Template != nil && secret.Format != "" {
+			resultErr = multierror.Append(resultErr, fmt.Errorf("secret %s cannot have both a template and a format configured", secret.Name()))
+			continue
+		}
 		if processedSecret, clash := fileLocations[secret.FilePath]; clash {
 			resultErr = multierror.Append(resultErr, fmt.Errorf("two secrets, %q and %q, are configured to write to the same location on disk: %s", processedSecret.Name(), secret.Name(), secret.FilePath))
 			continue
 		}
+		if len(secret.Env) > 0 && (secret.Template != nil || !envFormats[secret.Format]) {
+			resultErr = multierror.Append(resultErr, fmt.Errorf("secret %s has environment variables configured, which requires the json, json-data or yaml format", secret.Name()))
+			continue
+		}
+		clash := false
+		for _, env := range secret.Env {
+			if processedSecret, ok := envNames[env.Name]; ok {
+				resultErr = multierror.Append(resultErr, fmt.Errorf("two secrets, %q and %q, are configured to set the same environment variable: %s", processedSecret.Name(), secret.Name(), env.Name))
+				clash = true
+			}
+			envNames[env.Name] = secret
+		}
+		if clash {
+			continue
+		}
 		fileLocations[secret.FilePath] = secret
 
 		result = append(result, *secret)
@@ -141,6 +304,44 @@ func ParseConfiguredSecrets() ([]ConfiguredSecret, error) {
 	return result, resultErr
 }
 
+// envFormats are the formats that environment variables can be read from.
+var envFormats = map[render.Format]bool{
+	"":                    true,
+	render.FormatJSON:     true,
+	render.FormatJSONData: true,
+	render.FormatYAML:     true,
+}
+
+// parseEnvVars parses a comma-separated list of NAME=field mappings.
+func parseEnvVars(value string) ([]EnvVar, error) {
+	var env []EnvVar
+	seen := make(map[string]struct{})
+	for _, mapping := range strings.Split(value, ",") {
+		mapping = strings.TrimSpace(mapping)
+		if mapping == "" {
+			continue
+		}
+		name, field, ok := strings.Cut(mapping, "=")
+		name, field = strings.TrimSpace(name), strings.TrimSpace(field)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("%q must be of the form NAME=field", mapping)
+		}
+		if !envVarNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("%q is not a valid environment variable name", name)
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("environment variable %s is mapped more than once", name)
+		}
+		seen[name] = struct{}{}
+		env = append(env, EnvVar{Name: name, Field: field})
+	}
+	if len(env) == 0 {
+		return nil, errors.New("no environment variables given")
+	}
+
+	return env, nil
+}
+
 func filePathFromEnv(envFilePath string) string {
 	if envFilePath == "" {
 		return ""
@@ -151,3 +352,25 @@ func filePathFromEnv(envFilePath string) string {
 
 	return path.Join(DefaultSecretDirectory, envFilePath)
 }
+
+// parseTemplate parses the template configured for the named secret, reading
+// it from disk first if the value refers to a file.
+func parseTemplate(name, value string) (*template.Template, error) {
+	secretName := ConfiguredSecret{name: name}.Name()
+	text := value
+	if strings.HasPrefix(strings.TrimSpace(value), templateFilePrefix) {
+		templateFile := strings.TrimSpace(value)[len(templateFilePrefix):]
+		b, err := readFile(templateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template file %q for secret %s: %w", templateFile, secretName, err)
+		}
+		text = string(b)
+	}
+
+	tmpl, err := render.ParseTemplate(secretName, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template for secret %s: %w", secretName, err)
+	}
+
+	return tmpl, nil
+}
@@ -5,10 +5,16 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"testing"
 
 	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/render"
 )
 
 func TestParseConfiguredSecrets(t *testing.T) {
@@ -143,7 +149,7 @@ func TestParseConfiguredSecrets(t *testing.T) {
 				return secrets[i].name < secrets[j].name
 			})
 			for i, s := range secrets {
-				if s != tc.expected[i] {
+				if !reflect.DeepEqual(s, tc.expected[i]) {
 					t.Fatalf("Expected secret %+v but got %+v", tc.expected[i], s)
 				}
 			}
@@ -151,6 +157,246 @@ func TestParseConfiguredSecrets(t *testing.T) {
 	}
 }
 
+func TestParseConfiguredSecrets_Templates(t *testing.T) {
+	templateFile := filepath.Join(t.TempDir(), "pgpass.tmpl")
+	require.NoError(t, os.WriteFile(templateFile, []byte("{{ .Data.username }}:{{ .Data.password }}\n"), 0600))
+
+	t.Run("inline and file templates", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":            "/kv/data/foo",
+			"VAULT_SECRET_TEMPLATE":        "{{ toJSON (kvData .) }}",
+			"VAULT_SECRET_PATH_PGPASS":     "/database/creds/foo",
+			"VAULT_SECRET_FILE_PGPASS":     ".pgpass",
+			"VAULT_SECRET_TEMPLATE_PGPASS": "@" + templateFile,
+			"VAULT_SECRET_PATH_PLAIN":      "/kv/data/plain",
+			"VAULT_SECRET_FILE_PLAIN":      "plain.json",
+		})
+		secrets, err := ParseConfiguredSecrets()
+		require.NoError(t, err)
+		require.Len(t, secrets, 3)
+		sort.Slice(secrets, func(i, j int) bool {
+			return secrets[i].name < secrets[j].name
+		})
+
+		require.NotNil(t, secrets[0].Template)
+		require.NotNil(t, secrets[1].Template)
+		require.Equal(t, "/tmp/vault/.pgpass", secrets[1].FilePath)
+		require.Nil(t, secrets[2].Template)
+	})
+
+	t.Run("template errors", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":         "/kv/data/foo",
+			"VAULT_SECRET_TEMPLATE":     "{{ .Data.foo",
+			"VAULT_SECRET_PATH_FOO":     "/kv/data/foo",
+			"VAULT_SECRET_FILE_FOO":     "foo",
+			"VAULT_SECRET_TEMPLATE_FOO": "{{ notAFunction . }}",
+			"VAULT_SECRET_PATH_BAR":     "/kv/data/bar",
+			"VAULT_SECRET_FILE_BAR":     "bar",
+			"VAULT_SECRET_TEMPLATE_BAR": "@/does/not/exist",
+			"VAULT_SECRET_TEMPLATE_":    "{{ . }}",
+		})
+		_, err := ParseConfiguredSecrets()
+		require.Error(t, err)
+		merr, ok := err.(*multierror.Error)
+		require.True(t, ok)
+		require.Len(t, merr.Errors, 4, err.Error())
+	})
+}
+
+func TestParseConfiguredSecrets_Formats(t *testing.T) {
+	t.Run("valid formats", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":       "/kv/data/foo",
+			"VAULT_SECRET_FORMAT":     "dotenv",
+			"VAULT_SECRET_PATH_KEY":   "/kv/data/key",
+			"VAULT_SECRET_FILE_KEY":   "key.pem",
+			"VAULT_SECRET_FORMAT_KEY": "raw:private_key",
+		})
+		secrets, err := ParseConfiguredSecrets()
+		require.NoError(t, err)
+		require.Len(t, secrets, 2)
+		sort.Slice(secrets, func(i, j int) bool {
+			return secrets[i].name < secrets[j].name
+		})
+		require.Equal(t, render.FormatDotenv, secrets[0].Format)
+		require.Equal(t, render.Format("raw:private_key"), secrets[1].Format)
+	})
+
+	t.Run("format errors", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":         "/kv/data/foo",
+			"VAULT_SECRET_FORMAT":       "toml",
+			"VAULT_SECRET_PATH_FOO":     "/kv/data/foo",
+			"VAULT_SECRET_FILE_FOO":     "foo",
+			"VAULT_SECRET_FORMAT_FOO":   "yaml",
+			"VAULT_SECRET_TEMPLATE_FOO": "{{ . }}",
+		})
+		_, err := ParseConfiguredSecrets()
+		require.Error(t, err)
+		merr, ok := err.(*multierror.Error)
+		require.True(t, ok)
+		require.Len(t, merr.Errors, 2, err.Error())
+	})
+}
+
+func TestParseConfiguredSecrets_Modes(t *testing.T) {
+	t.Run("valid modes", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":     "/kv/data/foo",
+			"VAULT_SECRET_MODE":     "0640",
+			"VAULT_SECRET_PATH_FOO": "/kv/data/foo",
+			"VAULT_SECRET_FILE_FOO": "foo",
+			"VAULT_SECRET_MODE_FOO": "400",
+			"VAULT_SECRET_PATH_BAR": "/kv/data/bar",
+			"VAULT_SECRET_FILE_BAR": "bar",
+		})
+		secrets, err := ParseConfiguredSecrets()
+		require.NoError(t, err)
+		require.Len(t, secrets, 3)
+		sort.Slice(secrets, func(i, j int) bool {
+			return secrets[i].name < secrets[j].name
+		})
+		require.Equal(t, os.FileMode(0640), secrets[0].Mode)
+		require.Equal(t, os.FileMode(0), secrets[1].Mode)
+		require.Equal(t, os.FileMode(0400), secrets[2].Mode)
+	})
+
+	t.Run("invalid modes", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":     "/kv/data/foo",
+			"VAULT_SECRET_MODE":     "0999",
+			"VAULT_SECRET_PATH_FOO": "/kv/data/foo",
+			"VAULT_SECRET_FILE_FOO": "foo",
+			"VAULT_SECRET_MODE_FOO": "01777",
+			"VAULT_SECRET_PATH_BAR": "/kv/data/bar",
+			"VAULT_SECRET_FILE_BAR": "bar",
+			"VAULT_SECRET_MODE_BAR": "rw-------",
+		})
+		_, err := ParseConfiguredSecrets()
+		require.Error(t, err)
+		merr, ok := err.(*multierror.Error)
+		require.True(t, ok)
+		require.Len(t, merr.Errors, 3, err.Error())
+	})
+}
+
+func TestParseConfiguredSecrets_Methods(t *testing.T) {
+	t.Run("valid methods and data", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":       "/pki/issue/foo",
+			"VAULT_SECRET_METHOD":     "post",
+			"VAULT_SECRET_DATA":       `{"common_name": "foo.example.com", "ttl": "1h"}`,
+			"VAULT_SECRET_PATH_SSH":   "/ssh/sign/foo",
+			"VAULT_SECRET_FILE_SSH":   "ssh.json",
+			"VAULT_SECRET_METHOD_SSH": "PUT",
+			"VAULT_SECRET_PATH_KV":    "/kv/data/foo",
+			"VAULT_SECRET_FILE_KV":    "kv.json",
+			"VAULT_SECRET_METHOD_KV":  "GET",
+			"VAULT_SECRET_PATH_NONE":  "/kv/data/bar",
+			"VAULT_SECRET_FILE_NONE":  "bar.json",
+		})
+		secrets, err := ParseConfiguredSecrets()
+		require.NoError(t, err)
+		require.Len(t, secrets, 4)
+		sort.Slice(secrets, func(i, j int) bool {
+			return secrets[i].name < secrets[j].name
+		})
+
+		require.Equal(t, "POST", secrets[0].Method)
+		require.Equal(t, map[string]interface{}{"common_name": "foo.example.com", "ttl": "1h"}, secrets[0].Data)
+		require.True(t, secrets[0].IsWrite())
+		require.Equal(t, "GET", secrets[1].Method)
+		require.False(t, secrets[1].IsWrite())
+		require.Equal(t, "", secrets[2].Method)
+		require.False(t, secrets[2].IsWrite())
+		require.Equal(t, "PUT", secrets[3].Method)
+		require.Nil(t, secrets[3].Data)
+		require.True(t, secrets[3].IsWrite())
+	})
+
+	t.Run("method and data errors", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":       "/pki/issue/foo",
+			"VAULT_SECRET_METHOD":     "DELETE",
+			"VAULT_SECRET_PATH_FOO":   "/pki/issue/foo",
+			"VAULT_SECRET_FILE_FOO":   "foo",
+			"VAULT_SECRET_METHOD_FOO": "POST",
+			"VAULT_SECRET_DATA_FOO":   `["not", "an", "object"]`,
+			"VAULT_SECRET_PATH_BAR":   "/kv/data/bar",
+			"VAULT_SECRET_FILE_BAR":   "bar",
+			"VAULT_SECRET_DATA_BAR":   `{"foo": "bar"}`,
+		})
+		_, err := ParseConfiguredSecrets()
+		require.Error(t, err)
+		merr, ok := err.(*multierror.Error)
+		require.True(t, ok)
+		require.Len(t, merr.Errors, 3, err.Error())
+	})
+}
+
+func TestParseConfiguredSecrets_Env(t *testing.T) {
+	t.Run("valid environment variables", func(t *testing.T) {
+		setenv(map[string]string{
+			"VAULT_SECRET_PATH":      "/database/creds/foo",
+			"VAULT_SECRET_ENV":       "DB_USER=data.username, DB_PASSWORD = data.password",
+			"VAULT_SECRET_PATH_KV":   "/kv/data/foo",
+			"VAULT_SECRET_FILE_KV":   "kv.yaml",
+			"VAULT_SECRET_FORMAT_KV": "yaml",
+			"VAULT_SECRET_ENV_KV":    "API_KEY=api.key,",
+			"VAULT_SECRET_PATH_NONE": "/kv/data/bar",
+			"VAULT_SECRET_FILE_NONE": "bar.json",
+		})
+		secrets, err := ParseConfiguredSecrets()
+		require.NoError(t, err)
+		require.Len(t, secrets, 3)
+		sort.Slice(secrets, func(i, j int) bool {
+			return secrets[i].name < secrets[j].name
+		})
+
+		require.Equal(t, []EnvVar{{"DB_USER", "data.username"}, {"DB_PASSWORD", "data.password"}}, secrets[0].Env)
+		require.Equal(t, []EnvVar{{"API_KEY", "api.key"}}, secrets[1].Env)
+		require.Nil(t, secrets[2].Env)
+	})
+
+	for name, env := range map[string]map[string]string{
+		"missing field": {
+			"VAULT_SECRET_PATH": "/kv/data/foo",
+			"VAULT_SECRET_ENV":  "FOO",
+		},
+		"invalid name": {
+			"VAULT_SECRET_PATH": "/kv/data/foo",
+			"VAULT_SECRET_ENV":  "1FOO=data.foo",
+		},
+		"duplicate name": {
+			"VAULT_SECRET_PATH": "/kv/data/foo",
+			"VAULT_SECRET_ENV":  "FOO=data.foo,FOO=data.bar",
+		},
+		"empty": {
+			"VAULT_SECRET_PATH": "/kv/data/foo",
+			"VAULT_SECRET_ENV":  ",",
+		},
+		"unsupported format": {
+			"VAULT_SECRET_PATH":   "/kv/data/foo",
+			"VAULT_SECRET_FORMAT": "dotenv",
+			"VAULT_SECRET_ENV":    "FOO=foo",
+		},
+		"clash between secrets": {
+			"VAULT_SECRET_PATH":     "/kv/data/foo",
+			"VAULT_SECRET_ENV":      "FOO=data.foo",
+			"VAULT_SECRET_PATH_BAR": "/kv/data/bar",
+			"VAULT_SECRET_FILE_BAR": "bar.json",
+			"VAULT_SECRET_ENV_BAR":  "FOO=data.bar",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			setenv(env)
+			_, err := ParseConfiguredSecrets()
+			require.Error(t, err)
+		})
+	}
+}
+
 func setenv(env map[string]string) {
 	getenv = func(k string) string {
 		return env[k]
@@ -0,0 +1,70 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The fraction of a file-mode secret's lease duration after which it is
+	// read from Vault again and its file rewritten. Checked on every invoke.
+	VaultSecretRefreshFraction = "VAULT_SECRET_REFRESH_FRACTION"
+
+	// The maximum number of secrets read from Vault in parallel during init.
+	VaultSecretConcurrency = "VAULT_SECRET_CONCURRENCY"
+
+	// When set to `true`, secret files are overwritten with zeros before they
+	// are removed on shutdown.
+	VaultSecretOverwriteOnShutdown = "VAULT_SECRET_OVERWRITE_ON_SHUTDOWN"
+
+	DefaultSecretRefreshFraction = 0.8
+	DefaultSecretConcurrency     = 4
+)
+
+// SecretFileConfig holds config for writing secrets to disk in file mode.
+type SecretFileConfig struct {
+	RefreshFraction     float64
+	Concurrency         int
+	OverwriteOnShutdown bool
+}
+
+// SecretFileConfigFromEnv reads config from the environment for file mode.
+func SecretFileConfigFromEnv() SecretFileConfig {
+	refreshFraction := DefaultSecretRefreshFraction
+	refreshFractionEnv := strings.TrimSpace(os.Getenv(VaultSecretRefreshFraction))
+	if refreshFractionEnv != "" {
+		f, err := strconv.ParseFloat(refreshFractionEnv, 64)
+		if err == nil && f > 0 && f <= 1 {
+			refreshFraction = f
+		}
+	}
+
+	concurrency := DefaultSecretConcurrency
+	concurrencyEnv := strings.TrimSpace(os.Getenv(VaultSecretConcurrency))
+	if concurrencyEnv != "" {
+		c, err := strconv.Atoi(concurrencyEnv)
+		if err == nil && c > 0 {
+			concurrency = c
+		}
+	}
+
+	overwrite := false
+	overwriteEnv := strings.TrimSpace(os.Getenv(VaultSecretOverwriteOnShutdown))
+	if overwriteEnv != "" {
+		var err error
+		overwrite, err = strconv.ParseBool(overwriteEnv)
+		if err != nil {
+			overwrite = false
+		}
+	}
+
+	return SecretFileConfig{
+		RefreshFraction:     refreshFraction,
+		Concurrency:         concurrency,
+		OverwriteOnShutdown: overwrite,
+	}
+}
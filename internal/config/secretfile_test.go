@@ -0,0 +1,58 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretFileConfig(t *testing.T) {
+	t.Run("Default refresh fraction", func(t *testing.T) {
+		assert.Equal(t, DefaultSecretRefreshFraction, SecretFileConfigFromEnv().RefreshFraction)
+	})
+
+	t.Run("Valid refresh fraction", func(t *testing.T) {
+		defer os.Unsetenv(VaultSecretRefreshFraction)
+		os.Setenv(VaultSecretRefreshFraction, "0.5")
+		assert.Equal(t, 0.5, SecretFileConfigFromEnv().RefreshFraction)
+	})
+
+	t.Run("Invalid refresh fraction falls back to the default", func(t *testing.T) {
+		defer os.Unsetenv(VaultSecretRefreshFraction)
+		for _, f := range []string{"0", "-0.5", "1.5", "half"} {
+			os.Setenv(VaultSecretRefreshFraction, f)
+			assert.Equal(t, DefaultSecretRefreshFraction, SecretFileConfigFromEnv().RefreshFraction, f)
+		}
+	})
+
+	t.Run("Default concurrency", func(t *testing.T) {
+		assert.Equal(t, DefaultSecretConcurrency, SecretFileConfigFromEnv().Concurrency)
+	})
+
+	t.Run("Valid concurrency", func(t *testing.T) {
+		defer os.Unsetenv(VaultSecretConcurrency)
+		os.Setenv(VaultSecretConcurrency, "16")
+		assert.Equal(t, 16, SecretFileConfigFromEnv().Concurrency)
+	})
+
+	t.Run("Invalid concurrency falls back to the default", func(t *testing.T) {
+		defer os.Unsetenv(VaultSecretConcurrency)
+		for _, c := range []string{"0", "-1", "1.5", "many"} {
+			os.Setenv(VaultSecretConcurrency, c)
+			assert.Equal(t, DefaultSecretConcurrency, SecretFileConfigFromEnv().Concurrency, c)
+		}
+	})
+
+	t.Run("Overwrite on shutdown", func(t *testing.T) {
+		defer os.Unsetenv(VaultSecretOverwriteOnShutdown)
+		assert.False(t, SecretFileConfigFromEnv().OverwriteOnShutdown)
+		os.Setenv(VaultSecretOverwriteOnShutdown, "true")
+		assert.True(t, SecretFileConfigFromEnv().OverwriteOnShutdown)
+		os.Setenv(VaultSecretOverwriteOnShutdown, "yes please")
+		assert.False(t, SecretFileConfigFromEnv().OverwriteOnShutdown)
+	})
+}
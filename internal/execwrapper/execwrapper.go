@@ -0,0 +1,199 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// Package execwrapper runs as the Lambda runtime's exec wrapper. It waits for
+// the extension to write secrets to disk in file mode, sets environment
+// variables from them, then replaces itself with the runtime.
+package execwrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"gopkg.in/yaml.v3"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+	"github.com/hashicorp/vault-lambda-extension/internal/render"
+	"github.com/hashicorp/vault-lambda-extension/internal/runmode"
+)
+
+// pollInterval is how often to check whether a secret's file has been written.
+const pollInterval = 50 * time.Millisecond
+
+// Environ waits for the file of every secret with environment variables
+// configured to be written, then returns env with those variables added. A
+// variable already in env is replaced by the value from the secret. Values are
+// never logged.
+func Environ(ctx context.Context, logger hclog.Logger, secrets []config.ConfiguredSecret, env []string) ([]string, error) {
+	start := time.Now()
+	values := make(map[string]string)
+	secretCount := 0
+	for _, s := range secrets {
+		if len(s.Env) == 0 {
+			continue
+		}
+		if err := waitForFile(ctx, s.FilePath); err != nil {
+			return nil, fmt.Errorf("failed waiting for secret %s to be written to %s: %w", s.Name(), s.FilePath, err)
+		}
+		content, err := os.ReadFile(s.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file for secret %s: %w", s.Name(), err)
+		}
+		data, err := decode(content, s.Format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode file for secret %s: %w", s.Name(), err)
+		}
+
+		names := make([]string, 0, len(s.Env))
+		for _, e := range s.Env {
+			v, err := lookupField(data, e.Field)
+			if err != nil {
+				return nil, fmt.Errorf("failed to set %s from secret %s: %w", e.Name, s.Name(), err)
+			}
+			values[e.Name] = v
+			names = append(names, e.Name)
+		}
+		secretCount++
+		logger.Debug("Read environment variables from secret", "name", s.Name(), "variables", strings.Join(names, ","))
+	}
+
+	result := make([]string, 0, len(env)+len(values))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := values[name]; !ok {
+			result = append(result, kv)
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result = append(result, name+"="+values[name])
+	}
+
+	logger.Info(fmt.Sprintf("Set %d environment variables from %d secrets in %v", len(values), secretCount, time.Since(start)))
+	return result, nil
+}
+
+// CheckRunMode returns an error if any secret has environment variables
+// configured but the extension doesn't run in file mode. The secret's file
+// would never be written, so Environ would wait until it timed out.
+func CheckRunMode(mode runmode.Mode, secrets []config.ConfiguredSecret) error {
+	if mode.HasModeFile() {
+		return nil
+	}
+	for _, s := range secrets {
+		if len(s.Env) > 0 {
+			return fmt.Errorf("environment variables are configured for secret %s, but %s is %q so no secrets are written to disk; set it to %q or %q", s.Name(), config.VaultRunMode, mode, runmode.ModeFile, runmode.ModeDefault)
+		}
+	}
+
+	return nil
+}
+
+// Exec replaces the current process with the command in args, which is the
+// runtime and its arguments as passed to the exec wrapper by Lambda. It only
+// returns if the command could not be started.
+func Exec(args []string, env []string) error {
+	if len(args) == 0 {
+		return errors.New("no command given to exec")
+	}
+	argv0, err := exec.LookPath(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to find command %q: %w", args[0], err)
+	}
+
+	return syscall.Exec(argv0, args, env)
+}
+
+// waitForFile returns once a file exists at filePath. Secret files are written
+// atomically, so a file that exists is complete.
+func waitForFile(ctx context.Context, filePath string) error {
+	for {
+		_, err := os.Stat(filePath)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// decode parses a secret file written in one of the formats that support
+// environment variables.
+func decode(content []byte, format render.Format) (interface{}, error) {
+	var data interface{}
+	if format == render.FormatYAML {
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	d := json.NewDecoder(bytes.NewReader(content))
+	d.UseNumber()
+	if err := d.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// lookupField returns the value at the dot-separated path in data, such as
+// "data.password" or "data.ca_chain.0". Values that are not strings are
+// encoded as JSON.
+func lookupField(data interface{}, field string) (string, error) {
+	v := data
+	for _, part := range strings.Split(field, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = t[part]; !ok {
+				return "", fmt.Errorf("field %q not found", field)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(t) {
+				return "", fmt.Errorf("field %q not found: %q is not a valid index", field, part)
+			}
+			v = t[i]
+		default:
+			return "", fmt.Errorf("field %q not found", field)
+		}
+	}
+
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case nil:
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode field %q: %w", field, err)
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,131 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package execwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+	"github.com/hashicorp/vault-lambda-extension/internal/render"
+	"github.com/hashicorp/vault-lambda-extension/internal/runmode"
+)
+
+func TestEnviron(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "db.json")
+	kvFile := filepath.Join(dir, "kv.yaml")
+	require.NoError(t, os.WriteFile(kvFile, []byte("api:\n  key: abc\nport: 5432\n"), 0600))
+
+	secrets := []config.ConfiguredSecret{
+		{
+			VaultPath: "database/creds/foo",
+			FilePath:  dbFile,
+			Env:       []config.EnvVar{{Name: "DB_USER", Field: "data.username"}, {Name: "DB_PASSWORD", Field: "data.password"}},
+		},
+		{
+			VaultPath: "kv/data/foo",
+			FilePath:  kvFile,
+			Format:    render.FormatYAML,
+			Env:       []config.EnvVar{{Name: "API_KEY", Field: "api.key"}, {Name: "PORT", Field: "port"}},
+		},
+		{
+			VaultPath: "kv/data/bar",
+			FilePath:  filepath.Join(dir, "never-written.json"),
+		},
+	}
+
+	// Write the first file after the wrapper has started waiting.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = os.WriteFile(dbFile, []byte(`{"lease_duration": 3600, "data": {"username": "foo", "password": "bar"}}`), 0600)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	env, err := Environ(ctx, hclog.NewNullLogger(), secrets, []string{"PATH=/usr/bin", "DB_USER=old", "EMPTY="})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"PATH=/usr/bin",
+		"EMPTY=",
+		"API_KEY=abc",
+		"DB_PASSWORD=bar",
+		"DB_USER=foo",
+		"PORT=5432",
+	}, env)
+
+	t.Run("times out waiting for file", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := Environ(ctx, hclog.NewNullLogger(), []config.ConfiguredSecret{
+			{FilePath: filepath.Join(dir, "missing.json"), Env: []config.EnvVar{{Name: "FOO", Field: "foo"}}},
+		}, nil)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		_, err := Environ(context.Background(), hclog.NewNullLogger(), []config.ConfiguredSecret{
+			{FilePath: dbFile, Env: []config.EnvVar{{Name: "FOO", Field: "data.foo"}}},
+		}, nil)
+		require.Error(t, err)
+	})
+}
+
+func TestCheckRunMode(t *testing.T) {
+	withEnv := []config.ConfiguredSecret{
+		{VaultPath: "kv/data/foo", FilePath: "/tmp/vault/foo.json"},
+		{VaultPath: "kv/data/bar", FilePath: "/tmp/vault/bar.json", Env: []config.EnvVar{{Name: "FOO", Field: "data.foo"}}},
+	}
+	withoutEnv := withEnv[:1]
+
+	require.NoError(t, CheckRunMode(runmode.ModeDefault, withEnv))
+	require.NoError(t, CheckRunMode(runmode.ModeFile, withEnv))
+	require.NoError(t, CheckRunMode(runmode.ModeProxy, withoutEnv))
+	err := CheckRunMode(runmode.ModeProxy, withEnv)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "VAULT_RUN_MODE")
+}
+
+func TestLookupField(t *testing.T) {
+	var data interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"data": {
+			"password": "bar",
+			"ca_chain": ["ca", "root"],
+			"nested": {"enabled": true},
+			"empty": null
+		}
+	}`), &data))
+
+	for _, tc := range []struct {
+		field    string
+		expected string
+		err      bool
+	}{
+		{"data.password", "bar", false},
+		{"data.ca_chain.1", "root", false},
+		{"data.ca_chain", `["ca","root"]`, false},
+		{"data.nested", `{"enabled":true}`, false},
+		{"data.nested.enabled", "true", false},
+		{"data.empty", "", false},
+		{"data.missing", "", true},
+		{"data.ca_chain.2", "", true},
+		{"data.password.length", "", true},
+	} {
+		actual, err := lookupField(data, tc.field)
+		if tc.err {
+			require.Error(t, err, tc.field)
+			continue
+		}
+		require.NoError(t, err, tc.field)
+		require.Equal(t, tc.expected, actual, tc.field)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/ryanuber/go-glob"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+// permissionDeniedBody matches the response Vault gives when a policy denies a
+// request, so clients handle it the same way.
+const permissionDeniedBody = `{"errors":["permission denied"]}`
+
+// acl decides which requests the proxy forwards, using the rules from
+// config.ProxyConfig.
+type acl struct {
+	allow []config.ProxyRule
+	deny  []config.ProxyRule
+
+	// namespace is the namespace the proxy sends requests without an
+	// X-Vault-Namespace header to, and clientNamespace is the Vault client's
+	// namespace, which is also recognised at the start of a request's path.
+	namespace       string
+	clientNamespace string
+}
+
+// allowed returns false if the request matches a deny rule, or if there are
+// allow rules and it matches none of them, along with the reason it was denied.
+// Rules are matched against the path prefixed with the namespace the request
+// is sent to, so allow rules for a namespace must include it. Deny rules also
+// match the path relative to that namespace, the secrets namespace or the
+// client's namespace, so they apply in any of them. Within those namespaces,
+// rules for any namespace also match after leading segments of the path, as
+// they may be a child namespace.
+func (a acl) allowed(r *http.Request) (bool, string) {
+	if len(a.allow) == 0 && len(a.deny) == 0 {
+		return true, ""
+	}
+
+	p := namespacedVaultPath(r, a.namespace)
+	method := vaultMethod(r)
+	var relativePaths []string
+	for _, ns := range []string{requestNamespace(r, a.namespace), strings.Trim(a.namespace, "/"), strings.Trim(a.clientNamespace, "/")} {
+		if relative, ok := strings.CutPrefix(p, ns+"/"); ok && ns != "" {
+			relativePaths = append(relativePaths, relative)
+		}
+	}
+	for _, rule := range a.deny {
+		if ruleMatches(rule, p, method) {
+			return false, "deny rule " + rule.String()
+		}
+		for _, relative := range relativePaths {
+			if (rule.AnyNamespace && ruleMatchesAnySuffix(rule, relative, method)) || ruleMatches(rule, relative, method) {
+				return false, "deny rule " + rule.String()
+			}
+		}
+	}
+	if len(a.allow) == 0 {
+		return true, ""
+	}
+	for _, rule := range a.allow {
+		if ruleMatches(rule, p, method) {
+			return true, ""
+		}
+	}
+
+	return false, "no matching allow rule"
+}
+
+func ruleMatches(rule config.ProxyRule, p, method string) bool {
+	if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, method) {
+		return false
+	}
+
+	return glob.Glob(rule.Pattern, p)
+}
+
+// ruleMatchesAnySuffix reports whether the rule matches the path, or any part
+// of it that follows a "/".
+func ruleMatchesAnySuffix(rule config.ProxyRule, p, method string) bool {
+	for suffix := p; ; {
+		if ruleMatches(rule, suffix, method) {
+			return true
+		}
+		_, rest, found := strings.Cut(suffix, "/")
+		if !found {
+			return false
+		}
+		suffix = rest
+	}
+}
+
+// vaultPath returns the cleaned request path without the /v1/ prefix, as Vault
+// would route it. A trailing slash is kept, as it is used to list keys.
+func vaultPath(r *http.Request) string {
+	return cleanVaultPath(r.URL.Path)
+}
+
+// requestNamespace returns the namespace the request is sent to: the
+// X-Vault-Namespace header if the caller set one, otherwise defaultNamespace,
+// which the proxy adds.
+func requestNamespace(r *http.Request, defaultNamespace string) string {
+	if namespace := r.Header.Get(consts.NamespaceHeaderName); namespace != "" {
+		return strings.Trim(namespace, "/")
+	}
+
+	return strings.Trim(defaultNamespace, "/")
+}
+
+// namespacedVaultPath returns the request's Vault path, prefixed with the
+// namespace it is sent to, if any.
+func namespacedVaultPath(r *http.Request, defaultNamespace string) string {
+	return namespacedPath(requestNamespace(r, defaultNamespace), vaultPath(r))
+}
+
+// namespacedPath returns the cleaned Vault path prefixed with the namespace,
+// if any.
+func namespacedPath(namespace, p string) string {
+	if namespace == "" {
+		return p
+	}
+
+	return cleanVaultPath("/v1/" + namespace + "/" + p)
+}
+
+func cleanVaultPath(rawPath string) string {
+	p := strings.TrimPrefix(path.Clean("/"+rawPath), "/")
+	if strings.HasSuffix(rawPath, "/") && p != "" {
+		p += "/"
+	}
+
+	return strings.TrimPrefix(p, "v1/")
+}
+
+// vaultMethod returns the method Vault treats the request as, where a GET with
+// list=true is a LIST.
+func vaultMethod(r *http.Request) string {
+	method := strings.ToUpper(r.Method)
+	if method == http.MethodGet {
+		if list, _ := strconv.ParseBool(r.URL.Query().Get("list")); list {
+			return "LIST"
+		}
+	}
+
+	return method
+}
+
+func permissionDenied(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = w.Write([]byte(permissionDeniedBody))
+}
@@ -0,0 +1,119 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+func TestACL(t *testing.T) {
+	readApp := config.ProxyRule{Pattern: "secret/data/app/*", Methods: []string{"GET", "LIST"}}
+	anyDB := config.ProxyRule{Pattern: "database/creds/app"}
+
+	for name, tc := range map[string]struct {
+		acl      acl
+		method   string
+		target   string
+		expected bool
+	}{
+		"no rules allows everything":    {acl{}, http.MethodPost, "/v1/sys/policy/foo", true},
+		"allowed path and method":       {acl{allow: []config.ProxyRule{readApp}}, http.MethodGet, "/v1/secret/data/app/db", true},
+		"allowed nested path":           {acl{allow: []config.ProxyRule{readApp}}, http.MethodGet, "/v1/secret/data/app/a/b", true},
+		"allowed LIST method":           {acl{allow: []config.ProxyRule{readApp}}, "LIST", "/v1/secret/data/app/", true},
+		"allowed GET with list=true":    {acl{allow: []config.ProxyRule{readApp}}, http.MethodGet, "/v1/secret/data/app/?list=true", true},
+		"method not allowed":            {acl{allow: []config.ProxyRule{readApp}}, http.MethodPut, "/v1/secret/data/app/db", false},
+		"path not allowed":              {acl{allow: []config.ProxyRule{readApp}}, http.MethodGet, "/v1/secret/data/other", false},
+		"exact path with any method":    {acl{allow: []config.ProxyRule{anyDB}}, http.MethodPost, "/v1/database/creds/app", true},
+		"exact path doesn't match more": {acl{allow: []config.ProxyRule{anyDB}}, http.MethodGet, "/v1/database/creds/app2", false},
+		"deny only":                     {acl{deny: config.DefaultProxyDenyRules}, http.MethodGet, "/v1/secret/data/app/db", true},
+		"deny token create":             {acl{deny: config.DefaultProxyDenyRules}, http.MethodPost, "/v1/auth/token/create", false},
+		"deny orphan token create":      {acl{deny: config.DefaultProxyDenyRules}, http.MethodPost, "/v1/auth/token/create-orphan", false},
+		"deny sys":                      {acl{deny: config.DefaultProxyDenyRules}, http.MethodGet, "/v1/sys/mounts", false},
+		"deny after cleaning path":      {acl{deny: config.DefaultProxyDenyRules}, http.MethodGet, "/v1//secret/../sys/mounts", false},
+		"deny takes precedence": {
+			acl{allow: []config.ProxyRule{{Pattern: "*"}}, deny: config.DefaultProxyDenyRules},
+			http.MethodGet, "/v1/sys/mounts", false,
+		},
+		"deny limited to methods": {
+			acl{deny: []config.ProxyRule{{Pattern: "secret/*", Methods: []string{"DELETE"}}}},
+			http.MethodGet, "/v1/secret/data/app/db", true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+			allowed, _ := tc.acl.allowed(r)
+			assert.Equal(t, tc.expected, allowed)
+		})
+	}
+}
+
+func TestACL_Reason(t *testing.T) {
+	a := acl{
+		allow: []config.ProxyRule{{Pattern: "secret/data/*", Methods: []string{"GET", "LIST"}}},
+		deny:  config.DefaultProxyDenyRules,
+	}
+
+	allowed, reason := a.allowed(httptest.NewRequest(http.MethodGet, "/v1/sys/mounts", nil))
+	assert.False(t, allowed)
+	assert.Equal(t, "deny rule sys/*", reason)
+
+	allowed, reason = a.allowed(httptest.NewRequest(http.MethodPut, "/v1/secret/data/app", nil))
+	assert.False(t, allowed)
+	assert.Equal(t, "no matching allow rule", reason)
+
+	allowed, reason = a.allowed(httptest.NewRequest(http.MethodGet, "/v1/secret/data/app", nil))
+	assert.True(t, allowed)
+	assert.Empty(t, reason)
+}
+
+func TestACL_Namespaces(t *testing.T) {
+	deny := config.DefaultProxyDenyRules
+	denySecret := []config.ProxyRule{{Pattern: "secret/*"}}
+	readApp := []config.ProxyRule{{Pattern: "secret/data/app/*", Methods: []string{"GET"}}}
+	readTeamApp := []config.ProxyRule{{Pattern: "team/secret/data/app/*", Methods: []string{"GET"}}}
+
+	for name, tc := range map[string]struct {
+		acl       acl
+		method    string
+		target    string
+		namespace string
+		expected  bool
+	}{
+		"deny sys in path namespace":           {acl{deny: deny, clientNamespace: "team"}, http.MethodGet, "/v1/team/sys/mounts", "", false},
+		"deny token create in path namespace":  {acl{deny: deny, clientNamespace: "team"}, http.MethodPost, "/v1/team/child/auth/token/create", "", false},
+		"deny token create in child of header": {acl{deny: deny}, http.MethodPost, "/v1/child/auth/token/create", "admin", false},
+		"deny sys in child of secrets ns":      {acl{deny: deny, namespace: "team"}, http.MethodGet, "/v1/child/sys/mounts", "", false},
+		"deny sys in child of client ns":       {acl{deny: deny, namespace: "team", clientNamespace: "admin"}, http.MethodGet, "/v1/admin/child/sys/mounts", "", false},
+		"sys folder in KV path":                {acl{deny: deny}, http.MethodGet, "/v1/secret/data/app/sys/db", "", true},
+		"token create folder in KV path":       {acl{deny: deny}, http.MethodPost, "/v1/secret/data/auth/token/create", "", true},
+		"deny allows other namespaced paths":   {acl{deny: deny}, http.MethodGet, "/v1/team/secret/data/app/db", "team", true},
+		"deny rule within path":                {acl{deny: denySecret}, http.MethodGet, "/v1/kv/data/secret/x", "", true},
+		"deny rule in path namespace":          {acl{deny: denySecret}, http.MethodGet, "/v1/team/secret/x", "", true},
+		"deny sys in header namespace":         {acl{deny: deny}, http.MethodGet, "/v1/sys/mounts", "team", false},
+		"deny token create in header":          {acl{deny: deny}, http.MethodPost, "/v1/auth/token/create-orphan", "/team/", false},
+		"deny sys in secrets namespace":        {acl{deny: deny, namespace: "team"}, http.MethodGet, "/v1/sys/mounts", "", false},
+		"deny sys in client namespace path":    {acl{deny: deny, clientNamespace: "admin"}, http.MethodGet, "/v1/admin/sys/mounts", "", false},
+		"allow requires header namespace":      {acl{allow: readApp}, http.MethodGet, "/v1/secret/data/app/db", "team", false},
+		"allow requires secrets namespace":     {acl{allow: readApp, namespace: "team"}, http.MethodGet, "/v1/secret/data/app/db", "", false},
+		"allow header namespace":               {acl{allow: readTeamApp}, http.MethodGet, "/v1/secret/data/app/db", "team", true},
+		"allow secrets namespace":              {acl{allow: readTeamApp, namespace: "team"}, http.MethodGet, "/v1/secret/data/app/db", "", true},
+		"allow path namespace":                 {acl{allow: readTeamApp}, http.MethodGet, "/v1/team/secret/data/app/db", "", true},
+		"header overrides secrets namespace":   {acl{allow: readTeamApp, namespace: "team"}, http.MethodGet, "/v1/secret/data/app/db", "other", false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+			if tc.namespace != "" {
+				r.Header.Set("X-Vault-Namespace", tc.namespace)
+			}
+			allowed, _ := tc.acl.allowed(r)
+			assert.Equal(t, tc.expected, allowed)
+		})
+	}
+}
@@ -7,11 +7,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault-lambda-extension/internal/config"
@@ -32,6 +36,14 @@ const (
 
 	// Ignore the cache and send the request to Vault, do not cache the response
 	headerOptionNocache = "nocache"
+
+	// Remove all cached responses for the request's path before handling it
+	headerOptionEvict = "evict"
+
+	// cacheLeaseFraction is the fraction of a secret's lease or a token's TTL
+	// that a response holding it is cached for, so the function gets a new
+	// one from Vault before it expires.
+	cacheLeaseFraction = 0.8
 )
 
 type Cache struct {
@@ -44,6 +56,19 @@ type Cache struct {
 	// requestLocks is used during cache lookup to ensure that identical
 	// requests made in parallel do not all hit vault
 	requestLocks []*locksutil.LockEntry
+
+	// maxEntrySize is the largest response body that is cached
+	maxEntrySize int64
+
+	// ttl is the configured TTL, which entries may have a shorter TTL than
+	ttl time.Duration
+
+	// paths indexes the keys of cached entries by request path, so every entry
+	// for a path can be evicted when it is written to. keyPaths is the reverse
+	// index, used to remove keys when their entries are deleted or expire.
+	pathsMtx sync.Mutex
+	paths    map[string]map[string]struct{}
+	keyPaths map[string]string
 }
 
 type CacheKey struct {
@@ -56,20 +81,38 @@ type CacheData struct {
 	StatusCode int
 	Header     http.Header
 	Body       []byte
+
+	// TTL overrides the cache's TTL for this entry if set
+	TTL time.Duration
 }
 
 type CacheOptions struct {
 	cacheable bool
 	recache   bool
 	nocache   bool
+	evict     bool
 }
 
 func NewCache(cc config.CacheConfig) *Cache {
-	return &Cache{
+	maxEntrySize := cc.MaxEntrySize
+	if maxEntrySize <= 0 {
+		maxEntrySize = config.DefaultCacheMaxEntrySize
+	}
+
+	c := &Cache{
 		data:         gocache.New(cc.TTL, cc.TTL),
 		defaultOn:    cc.DefaultEnabled,
 		requestLocks: locksutil.CreateLocks(),
+		maxEntrySize: maxEntrySize,
+		ttl:          cc.TTL,
+		paths:        make(map[string]map[string]struct{}),
+		keyPaths:     make(map[string]string),
 	}
+	c.data.OnEvicted(func(keyStr string, _ interface{}) {
+		c.unindex(keyStr)
+	})
+
+	return c
 }
 
 // constructs the CacheKey for this request and token and returns the SHA256
@@ -139,8 +182,23 @@ func computeRequestID(key *CacheKey) (string, error) {
 	return hex.EncodeToString(cryptoutil.Blake2b256Hash(b.String())), nil
 }
 
-func (c *Cache) Set(keyStr string, data *CacheData) {
-	c.data.Set(keyStr, data, gocache.DefaultExpiration)
+// Set caches the response for a request to the given Vault path.
+func (c *Cache) Set(keyStr string, path string, data *CacheData) {
+	ttl := gocache.DefaultExpiration
+	if data.TTL > 0 {
+		ttl = data.TTL
+	}
+
+	// Hold the lock while setting, so Flush can't clear the index in between.
+	c.pathsMtx.Lock()
+	defer c.pathsMtx.Unlock()
+	p := indexPath(path)
+	if c.paths[p] == nil {
+		c.paths[p] = make(map[string]struct{})
+	}
+	c.paths[p][keyStr] = struct{}{}
+	c.keyPaths[keyStr] = p
+	c.data.Set(keyStr, data, ttl)
 }
 
 func (c *Cache) Get(keyStr string) (data *CacheData, err error) {
@@ -160,6 +218,97 @@ func (c *Cache) Remove(keyStr string) {
 	c.data.Delete(keyStr)
 }
 
+// Evict removes every cached response for requests to the given Vault path,
+// with or without a trailing slash, and returns how many were removed.
+func (c *Cache) Evict(path string) int {
+	c.pathsMtx.Lock()
+	keys := make([]string, 0, len(c.paths[indexPath(path)]))
+	for keyStr := range c.paths[indexPath(path)] {
+		keys = append(keys, keyStr)
+	}
+	c.pathsMtx.Unlock()
+
+	// Deleting calls unindex, so the lock must not be held.
+	for _, keyStr := range keys {
+		c.data.Delete(keyStr)
+	}
+
+	return len(keys)
+}
+
+// EvictAfterWrite removes every cached response for requests to the given
+// Vault path in the namespace, and if it is a KV v2 path, for the same
+// secret's data/ and metadata/ paths too, as writing, deleting or destroying a
+// version of a secret changes both.
+func (c *Cache) EvictAfterWrite(namespace, path string) int {
+	n := c.Evict(namespacedPath(namespace, path))
+	for _, p := range kvV2SecretPaths(path) {
+		n += c.Evict(namespacedPath(namespace, p))
+	}
+
+	return n
+}
+
+// kvV2Endpoints are the KV v2 endpoints that act on a secret, each followed by
+// the secret's key.
+var kvV2Endpoints = map[string]struct{}{
+	"data":     {},
+	"metadata": {},
+	"delete":   {},
+	"undelete": {},
+	"destroy":  {},
+}
+
+// kvV2SecretPaths returns the data/ and metadata/ paths of the secret, if the
+// path is to a KV v2 endpoint for a single secret. KV v2 can be mounted at any
+// path, so the first segment after the mount that names a KV v2 endpoint is
+// taken to be one.
+func kvV2SecretPaths(path string) []string {
+	if strings.HasSuffix(path, "/") {
+		return nil
+	}
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments)-1; i++ {
+		if _, ok := kvV2Endpoints[segments[i]]; !ok {
+			continue
+		}
+		mount := strings.Join(segments[:i], "/")
+		key := strings.Join(segments[i+1:], "/")
+		return []string{mount + "/data/" + key, mount + "/metadata/" + key}
+	}
+
+	return nil
+}
+
+// Flush removes every cached response.
+func (c *Cache) Flush() {
+	c.pathsMtx.Lock()
+	defer c.pathsMtx.Unlock()
+	c.data.Flush()
+	c.paths = make(map[string]map[string]struct{})
+	c.keyPaths = make(map[string]string)
+}
+
+func (c *Cache) unindex(keyStr string) {
+	c.pathsMtx.Lock()
+	defer c.pathsMtx.Unlock()
+	p, ok := c.keyPaths[keyStr]
+	if !ok {
+		return
+	}
+	delete(c.keyPaths, keyStr)
+	delete(c.paths[p], keyStr)
+	if len(c.paths[p]) == 0 {
+		delete(c.paths, p)
+	}
+}
+
+// indexPath ignores a trailing slash, so that writing to a path also evicts
+// any cached list of keys below it.
+func indexPath(path string) string {
+	return strings.TrimSuffix(path, "/")
+}
+
 func setupCache(cacheConfig config.CacheConfig) *Cache {
 	if cacheConfig.TTL <= 0 {
 		return nil
@@ -176,6 +325,7 @@ func parseCacheOptions(cacheControlHeaders []string) *CacheOptions {
 		cacheable: strutil.StrListContains(values, headerOptionCacheable),
 		recache:   strutil.StrListContains(values, headerOptionRecache),
 		nocache:   strutil.StrListContains(values, headerOptionNocache),
+		evict:     strutil.StrListContains(values, headerOptionEvict),
 	}
 
 	return options
@@ -199,16 +349,118 @@ func shallRefreshCache(r *http.Request, cache *Cache) bool {
 	return r.Method == http.MethodGet && cacheable
 }
 
+func shallEvictCache(r *http.Request, cache *Cache) bool {
+	if cache == nil {
+		return false
+	}
+	options := parseCacheOptions(r.Header.Values(VaultCacheControlHeaderName))
+	return options.evict
+}
+
+// shallEvictAfterWrite returns true for requests that can change the secret at
+// their path, once Vault has responded successfully.
+func shallEvictAfterWrite(r *http.Request, resp *http.Response, cache *Cache) bool {
+	if cache == nil || resp.StatusCode >= 300 {
+		return false
+	}
+	switch r.Method {
+	case http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
 func fetchFromCache(w http.ResponseWriter, data *CacheData) {
 	copyHeaders(w.Header(), data.Header)
 	w.WriteHeader(data.StatusCode)
 	w.Write(data.Body)
 }
 
-func retrieveData(resp *http.Response, body []byte) *CacheData {
+// cappedBuffer saves what is written to it until it exceeds max bytes, after
+// which it discards everything. Writes never fail, so it can be used with
+// io.TeeReader while streaming a response.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.exceeded {
+		return len(p), nil
+	}
+	if int64(b.buf.Len()+len(p)) > b.max {
+		b.exceeded = true
+		b.buf = bytes.Buffer{}
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+// retrieveData returns the cache entry for a response. Its TTL is the given
+// TTL, unless the response holds a secret or token that expires sooner.
+func retrieveData(resp *http.Response, body []byte, ttl time.Duration) *CacheData {
 	return &CacheData{
 		StatusCode: resp.StatusCode,
 		Header:     resp.Header,
 		Body:       body,
+		TTL:        entryTTL(ttl, body),
+	}
+}
+
+// entryTTL returns the shortest of ttl and cacheLeaseFraction of the lease
+// duration, token TTL, response-wrapping TTL or "ttl" field in the response.
+func entryTTL(ttl time.Duration, body []byte) time.Duration {
+	secret, err := api.ParseSecret(bytes.NewReader(body))
+	if err != nil || secret == nil {
+		return ttl
+	}
+
+	durations := []time.Duration{
+		time.Duration(secret.LeaseDuration) * time.Second,
+		dataTTL(secret.Data),
+	}
+	if secret.Auth != nil {
+		durations = append(durations, time.Duration(secret.Auth.LeaseDuration)*time.Second)
 	}
+	if secret.WrapInfo != nil {
+		durations = append(durations, time.Duration(secret.WrapInfo.TTL)*time.Second)
+	}
+	// KV v2 nests the secret's data.
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
+		durations = append(durations, dataTTL(data))
+	}
+
+	for _, d := range durations {
+		if d <= 0 {
+			continue
+		}
+		if fraction := time.Duration(float64(d) * cacheLeaseFraction); fraction < ttl {
+			ttl = fraction
+		}
+	}
+
+	return ttl
+}
+
+// dataTTL parses the "ttl" field in a response's data, as returned for tokens
+// by auth/token/lookup and set on KV secrets. It is a number of seconds or a
+// duration string. It returns 0 if there is no valid TTL.
+func dataTTL(data map[string]interface{}) time.Duration {
+	switch v := data["ttl"].(type) {
+	case json.Number:
+		if seconds, err := v.Int64(); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	case string:
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+
+	return 0
 }
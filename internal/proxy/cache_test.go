@@ -289,7 +289,7 @@ func TestGetAfterSet(t *testing.T) {
 		cacheKeyHash, err := computeRequestID(&cacheKey)
 		require.NoError(t, err)
 		require.NotEmpty(t, cacheKeyHash)
-		cache.Set(cacheKeyHash, cacheData)
+		cache.Set(cacheKeyHash, "test", cacheData)
 
 		cacheDataOut, err := cache.Get(cacheKeyHash)
 		require.NoError(t, err)
@@ -318,7 +318,7 @@ func TestGetAfterSet(t *testing.T) {
 		cacheKeyHash, err := computeRequestID(&cacheKey)
 		require.NoError(t, err)
 		require.NotEmpty(t, cacheKeyHash)
-		cache.Set(cacheKeyHash, cacheData)
+		cache.Set(cacheKeyHash, "test", cacheData)
 
 		time.Sleep(20 * time.Millisecond)
 		cacheDataOut, err := cache.Get(cacheKeyHash)
@@ -335,7 +335,7 @@ func TestGetAfterSet(t *testing.T) {
 			StatusCode: http.StatusOK,
 		}
 		cacheKey := "test-key"
-		cache.Set(cacheKey, cacheData)
+		cache.Set(cacheKey, "test", cacheData)
 
 		time.Sleep(5 * time.Second)
 		cacheDataOut, err := cache.Get(cacheKey)
@@ -580,6 +580,167 @@ func TestRetrieveData(t *testing.T) {
 		Request:       r,
 		Header:        make(http.Header),
 	}
-	cacheData := retrieveData(resp, []byte(body))
+	cacheData := retrieveData(resp, []byte(body), time.Minute)
 	require.Truef(t, cacheData.StatusCode == statusCode && string(cacheData.Body) == body, `retrieveData() shall return the same body: %s`, body)
+	require.Equal(t, time.Minute, cacheData.TTL)
+}
+
+func TestEntryTTL(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body     string
+		expected time.Duration
+	}{
+		"not JSON":                  {`Hello World`, 10 * time.Minute},
+		"no lease":                  {`{"data":{"foo":"bar"}}`, 10 * time.Minute},
+		"long lease":                {`{"lease_duration":86400,"data":{"foo":"bar"}}`, 10 * time.Minute},
+		"short lease":               {`{"lease_id":"database/creds/app/abc","lease_duration":300,"renewable":true}`, 4 * time.Minute},
+		"KV v1 ttl in seconds":      {`{"data":{"foo":"bar","ttl":60}}`, 48 * time.Second},
+		"KV v1 ttl as duration":     {`{"data":{"foo":"bar","ttl":"1m"}}`, 48 * time.Second},
+		"KV v2 ttl":                 {`{"data":{"data":{"foo":"bar","ttl":"60"},"metadata":{}}}`, 48 * time.Second},
+		"invalid ttl":               {`{"data":{"foo":"bar","ttl":"soon"}}`, 10 * time.Minute},
+		"non-renewable token":       {`{"auth":{"client_token":"s.abc","lease_duration":120,"renewable":false}}`, 96 * time.Second},
+		"token without TTL":         {`{"auth":{"client_token":"s.root","lease_duration":0}}`, 10 * time.Minute},
+		"token lookup":              {`{"data":{"id":"s.abc","ttl":300,"renewable":false}}`, 4 * time.Minute},
+		"wrapped response":          {`{"wrap_info":{"token":"s.wrap","ttl":30}}`, 24 * time.Second},
+		"shortest of lease and ttl": {`{"lease_duration":600,"data":{"ttl":100}}`, 80 * time.Second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, entryTTL(10*time.Minute, []byte(tc.body)))
+		})
+	}
+}
+
+func TestSet_EntryTTL(t *testing.T) {
+	cache := NewCache(config.CacheConfig{TTL: time.Minute})
+	cache.Set("short", "test", &CacheData{StatusCode: http.StatusOK, TTL: 10 * time.Millisecond})
+	cache.Set("default", "test", &CacheData{StatusCode: http.StatusOK})
+
+	time.Sleep(20 * time.Millisecond)
+	short, err := cache.Get("short")
+	require.NoError(t, err)
+	assert.Nil(t, short)
+	long, err := cache.Get("default")
+	require.NoError(t, err)
+	assert.NotNil(t, long)
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 8}
+	n, err := b.Write([]byte("abcd"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	_, err = b.Write([]byte("efgh"))
+	require.NoError(t, err)
+	assert.False(t, b.exceeded)
+	assert.Equal(t, "abcdefgh", b.buf.String())
+
+	n, err = b.Write([]byte("i"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, b.exceeded)
+	assert.Zero(t, b.buf.Len())
+
+	_, err = b.Write([]byte("j"))
+	require.NoError(t, err)
+	assert.True(t, b.exceeded)
+	assert.Zero(t, b.buf.Len())
+}
+
+func TestEvict(t *testing.T) {
+	cache := NewCache(config.CacheConfig{TTL: time.Minute})
+	data := &CacheData{StatusCode: http.StatusOK}
+	cache.Set("foo-token1", "secret/data/foo", data)
+	cache.Set("foo-token2", "secret/data/foo", data)
+	cache.Set("foo-list", "secret/data/foo/", data)
+	cache.Set("bar", "secret/data/bar", data)
+
+	assert.Equal(t, 3, cache.Evict("secret/data/foo"))
+	for _, key := range []string{"foo-token1", "foo-token2", "foo-list"} {
+		out, err := cache.Get(key)
+		require.NoError(t, err)
+		assert.Nil(t, out, key)
+	}
+	out, err := cache.Get("bar")
+	require.NoError(t, err)
+	assert.NotNil(t, out)
+	assert.Equal(t, 0, cache.Evict("secret/data/foo"))
+
+	// The index is cleaned up when entries are removed.
+	cache.Remove("bar")
+	assert.Empty(t, cache.paths)
+	assert.Empty(t, cache.keyPaths)
+
+	cache.Set("baz", "secret/data/baz", data)
+	cache.Flush()
+	out, err = cache.Get("baz")
+	require.NoError(t, err)
+	assert.Nil(t, out)
+	assert.Empty(t, cache.paths)
+	assert.Equal(t, 0, cache.Evict("secret/data/baz"))
+}
+
+func TestEvictAfterWrite(t *testing.T) {
+	cache := NewCache(config.CacheConfig{TTL: time.Minute})
+	data := &CacheData{StatusCode: http.StatusOK}
+	cache.Set("data", "secret/data/app/foo", data)
+	cache.Set("metadata", "secret/metadata/app/foo", data)
+	cache.Set("other", "secret/data/app/bar", data)
+	cache.Set("namespaced", "team/data/secret/data/app/foo", data)
+
+	assert.Equal(t, 2, cache.EvictAfterWrite("", "secret/destroy/app/foo"))
+	assert.Equal(t, 1, cache.EvictAfterWrite("team/data", "secret/metadata/app/foo"))
+	out, err := cache.Get("other")
+	require.NoError(t, err)
+	assert.NotNil(t, out)
+}
+
+func TestKVV2SecretPaths(t *testing.T) {
+	for path, expected := range map[string][]string{
+		"secret/data/foo":            {"secret/data/foo", "secret/metadata/foo"},
+		"secret/metadata/foo":        {"secret/data/foo", "secret/metadata/foo"},
+		"secret/delete/foo":          {"secret/data/foo", "secret/metadata/foo"},
+		"secret/undelete/foo":        {"secret/data/foo", "secret/metadata/foo"},
+		"secret/destroy/app/foo":     {"secret/data/app/foo", "secret/metadata/app/foo"},
+		"team/kv/app/metadata/a/b":   {"team/kv/app/data/a/b", "team/kv/app/metadata/a/b"},
+		"secret/metadata/foo/":       nil,
+		"secret/config":              nil,
+		"database/creds/app":         nil,
+		"data/foo":                   nil,
+		"auth/token/lookup-self":     nil,
+		"secret/metadata":            nil,
+		"kv/delete/foo/undelete/bar": {"kv/data/foo/undelete/bar", "kv/metadata/foo/undelete/bar"},
+	} {
+		assert.Equal(t, expected, kvV2SecretPaths(path), path)
+	}
+}
+
+func TestShallEvictCache(t *testing.T) {
+	cache := NewCache(config.CacheConfig{TTL: 10 * time.Second})
+	r := httptest.NewRequest("GET", "/v1/uuid/s1", nil)
+	assert.False(t, shallEvictCache(r, cache))
+	r.Header.Add(VaultCacheControlHeaderName, "nocache,evict")
+	assert.True(t, shallEvictCache(r, cache))
+	assert.False(t, shallEvictCache(r, nil))
+}
+
+func TestShallEvictAfterWrite(t *testing.T) {
+	cache := NewCache(config.CacheConfig{TTL: 10 * time.Second})
+	for _, tc := range []struct {
+		method     string
+		statusCode int
+		expected   bool
+	}{
+		{http.MethodGet, http.StatusOK, false},
+		{"LIST", http.StatusOK, false},
+		{http.MethodPut, http.StatusNoContent, true},
+		{http.MethodPost, http.StatusOK, true},
+		{http.MethodPatch, http.StatusOK, true},
+		{http.MethodDelete, http.StatusNoContent, true},
+		{http.MethodPut, http.StatusForbidden, false},
+	} {
+		r := httptest.NewRequest(tc.method, "/v1/secret/data/foo", nil)
+		resp := &http.Response{StatusCode: tc.statusCode}
+		assert.Equal(t, tc.expected, shallEvictAfterWrite(r, resp, cache), tc)
+		assert.False(t, shallEvictAfterWrite(r, resp, nil))
+	}
 }
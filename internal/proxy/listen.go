@@ -0,0 +1,41 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+// Listen returns a listener for the proxy server. For a Unix domain socket, a
+// stale socket left by a previous process is removed first, and the socket's
+// permissions are set once it is created.
+func Listen(cfg config.ProxyConfig) (net.Listener, error) {
+	if cfg.Network != "unix" {
+		return net.Listen(cfg.Network, cfg.Address)
+	}
+
+	if fi, err := os.Lstat(cfg.Address); err == nil {
+		if fi.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s already exists and is not a socket", cfg.Address)
+		}
+		if err := os.Remove(cfg.Address); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(cfg.Address, cfg.SocketMode); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return ln, nil
+}
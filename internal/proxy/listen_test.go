@@ -0,0 +1,77 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+func TestListen(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		ln, err := Listen(config.ProxyConfig{Network: "tcp", Address: "127.0.0.1:0"})
+		require.NoError(t, err)
+		defer ln.Close()
+		require.Equal(t, "tcp", ln.Addr().Network())
+	})
+
+	t.Run("Unix socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "vault.sock")
+		ln, err := Listen(config.ProxyConfig{Network: "unix", Address: path, SocketMode: 0660})
+		require.NoError(t, err)
+		defer ln.Close()
+
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.ModeSocket, fi.Mode().Type())
+		require.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+
+		srv := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})}
+		go func() {
+			_ = srv.Serve(ln)
+		}()
+		defer srv.Close()
+
+		client := http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+		resp, err := client.Get("http://localhost/v1/sys/health")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusTeapot, resp.StatusCode)
+	})
+
+	t.Run("replaces a stale socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "vault.sock")
+		stale, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		// Leave the socket file behind, as a process that was killed would.
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		ln, err := Listen(config.ProxyConfig{Network: "unix", Address: path, SocketMode: 0600})
+		require.NoError(t, err)
+		require.NoError(t, ln.Close())
+	})
+
+	t.Run("refuses to replace a regular file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "vault.sock")
+		require.NoError(t, os.WriteFile(path, []byte("not a socket"), 0600))
+
+		_, err := Listen(config.ProxyConfig{Network: "unix", Address: path, SocketMode: 0600})
+		require.ErrorContains(t, err, "not a socket")
+	})
+}
@@ -4,7 +4,6 @@
 package proxy
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"net/http"
@@ -22,13 +21,26 @@ const (
 	VaultTokenOptionsHeaderName = "X-Vault-Token-Options"
 	headerOptionRevokeToken     = "revoke"
 	proxyUserAgent              = "; requesting from proxy"
+
+	// CacheEndpointPath is handled by the extension rather than proxied.
+	// DELETE requests evict cached responses for the Vault path given in the
+	// "path" query parameter, or every cached response if it is omitted.
+	CacheEndpointPath = "/_vle/cache"
 )
 
-// New returns an unstarted HTTP server with health and proxy handlers.
-func New(logger hclog.Logger, client *vault.Client, cacheConfig config.CacheConfig) *http.Server {
+// New returns an unstarted HTTP server with health and proxy handlers. Requests
+// are only forwarded if they are allowed by the rules in proxyConfig.
+func New(logger hclog.Logger, client *vault.Client, cacheConfig config.CacheConfig, proxyConfig config.ProxyConfig) *http.Server {
 	cache := setupCache(cacheConfig)
+	acl := acl{
+		allow:           proxyConfig.Allow,
+		deny:            proxyConfig.Deny,
+		namespace:       client.SecretsNamespace(),
+		clientNamespace: client.VaultClient.Namespace(),
+	}
 	mux := http.ServeMux{}
-	mux.HandleFunc("/", proxyHandler(logger, client, cache))
+	mux.HandleFunc("/", proxyHandler(logger, client, cache, acl))
+	mux.HandleFunc(CacheEndpointPath, cacheHandler(logger, cache, client.SecretsNamespace()))
 	srv := http.Server{
 		Handler: &mux,
 	}
@@ -38,8 +50,22 @@ func New(logger hclog.Logger, client *vault.Client, cacheConfig config.CacheConf
 
 // The proxyHandler borrows from the Send function in Vault Agent's proxy:
 // https://github.com/hashicorp/vault/blob/22b486b651b8956d32fb24e77cef4050df7094b6/command/agent/cache/api_proxy.go
-func proxyHandler(logger hclog.Logger, client *vault.Client, cache *Cache) func(http.ResponseWriter, *http.Request) {
+func proxyHandler(logger hclog.Logger, client *vault.Client, cache *Cache, acl acl) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if allowed, reason := acl.allowed(r); !allowed {
+			logger.Warn("Denied proxy request", "method", vaultMethod(r), "path", namespacedVaultPath(r, acl.namespace), "reason", reason)
+			permissionDenied(w)
+			return
+		}
+
+		// Cached responses are indexed by the namespace the request is sent
+		// to, so writes only evict responses from the same namespace.
+		namespace := requestNamespace(r, client.SecretsNamespace())
+		if shallEvictCache(r, cache) {
+			n := cache.Evict(namespacedPath(namespace, vaultPath(r)))
+			logger.Debug(fmt.Sprintf("Evicted %d cached responses for: %s", n, r.URL.Path))
+		}
+
 		if shouldRevokeToken(r.Header) {
 			client.RevokeToken()
 		}
@@ -51,7 +77,7 @@ func proxyHandler(logger hclog.Logger, client *vault.Client, cache *Cache) func(
 		}
 
 		logger.Debug(fmt.Sprintf("Proxying %s %s", r.Method, r.URL.Path))
-		fwReq, err := proxyRequest(r, client.VaultConfig.Address, token)
+		fwReq, err := proxyRequest(r, client.VaultConfig.Address, client.SecretsNamespace(), token)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("failed to generate proxy request: %s", err), http.StatusInternalServerError)
 			return
@@ -98,34 +124,72 @@ func proxyHandler(logger hclog.Logger, client *vault.Client, cache *Cache) func(
 
 		defer resp.Body.Close()
 
-		// Save the response body
-		var buf bytes.Buffer
-		_, err = io.Copy(&buf, resp.Body)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("failed to read response body: %s", err), http.StatusInternalServerError)
-			return
-		}
-		respBody := buf.Bytes()
-
-		if doCacheSet && resp.StatusCode < 300 {
-			cache.Set(cacheKeyHash, retrieveData(resp, respBody))
-			logger.Debug(fmt.Sprintf("Refreshed cache for: %s %s", r.Method, r.URL.Path))
+		// A successful write may have changed the secret at this path, so
+		// cached reads of it are stale.
+		if shallEvictAfterWrite(r, resp, cache) {
+			n := cache.EvictAfterWrite(namespace, vaultPath(r))
+			logger.Debug(fmt.Sprintf("Evicted %d cached responses after %s %s", n, r.Method, r.URL.Path))
 		}
 
 		copyHeaders(w.Header(), resp.Header)
 		w.WriteHeader(resp.StatusCode)
 
-		_, err = w.Write(respBody)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("failed to write response back to requester: %s", err), http.StatusInternalServerError)
+		// Stream the response body back to the requester. If it should be
+		// cached, it is also saved as it is streamed, unless it is too large.
+		// Once the status is written, errors can only be logged.
+		var body io.Reader = resp.Body
+		var cached *cappedBuffer
+		if doCacheSet && resp.StatusCode < 300 {
+			cached = &cappedBuffer{max: cache.maxEntrySize}
+			body = io.TeeReader(resp.Body, cached)
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			logger.Error("failed to stream response back to requester", "error", err)
 			return
 		}
 
+		if cached != nil {
+			if cached.exceeded {
+				logger.Debug(fmt.Sprintf("Response larger than %d bytes not cached for: %s %s", cache.maxEntrySize, r.Method, r.URL.Path))
+			} else {
+				data := retrieveData(resp, cached.buf.Bytes(), cache.ttl)
+				cache.Set(cacheKeyHash, namespacedPath(namespace, vaultPath(r)), data)
+				logger.Debug(fmt.Sprintf("Refreshed cache for %v: %s %s", data.TTL, r.Method, r.URL.Path))
+			}
+		}
+
 		logger.Debug(fmt.Sprintf("Successfully proxied %s %s", r.Method, r.URL.Path))
 	}
 }
 
-func proxyRequest(r *http.Request, vaultAddress string, token string) (*http.Request, error) {
+// cacheHandler serves CacheEndpointPath. The path to evict is in the
+// namespace from the request's X-Vault-Namespace header, or otherwise the
+// given default namespace, as for proxied requests.
+func cacheHandler(logger hclog.Logger, cache *Cache, defaultNamespace string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", http.MethodDelete)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if cache != nil {
+			if p := r.URL.Query().Get("path"); p != "" {
+				p = namespacedPath(requestNamespace(r, defaultNamespace), cleanVaultPath(p))
+				n := cache.Evict(p)
+				logger.Info(fmt.Sprintf("Evicted %d cached responses for %s", n, p))
+			} else {
+				cache.Flush()
+				logger.Info("Evicted all cached responses")
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// proxyRequest copies r to be sent to Vault with the given token. The namespace
+// is only added if the caller hasn't set one.
+func proxyRequest(r *http.Request, vaultAddress string, namespace string, token string) (*http.Request, error) {
 	// http.Transport will transparently request gzip and decompress the response, but only if
 	// the client doesn't manually set the header. Removing any Accept-Encoding header allows the
 	// transparent compression to occur.
@@ -145,6 +209,9 @@ func proxyRequest(r *http.Request, vaultAddress string, token string) (*http.Req
 	}
 	fwReq.Header = r.Header
 	fwReq.Header.Add(consts.AuthHeaderName, token)
+	if namespace != "" && fwReq.Header.Get(consts.NamespaceHeaderName) == "" {
+		fwReq.Header.Set(consts.NamespaceHeaderName, namespace)
+	}
 
 	// add user agent header
 	ua := config.GetUserAgentBase(config.ExtensionName, config.ExtensionVersion)
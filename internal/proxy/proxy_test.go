@@ -14,6 +14,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -70,7 +71,7 @@ func TestProxy(t *testing.T) {
 	require.NoError(t, err, "failed to load AWS config ")
 	fakeSTS, awsCfg := ststest.FakeSTS(&awsCfg)
 	defer fakeSTS.Close()
-	proxyAddr, cleanup := startProxy(t, fakeVault.URL, awsCfg)
+	proxyAddr, cleanup := startProxy(t, fakeVault.URL, awsCfg, internalconfig.CacheConfig{}, internalconfig.ProxyConfig{})
 	defer cleanup()
 
 	t.Run("happy path bare http client", func(t *testing.T) {
@@ -154,7 +155,256 @@ func TestProxy(t *testing.T) {
 	})
 }
 
-func startProxy(t *testing.T, vaultAddress string, awsCfg aws.Config) (string, func() error) {
+func TestProxy_ACL(t *testing.T) {
+	fakeVault := fakeVault()
+	defer fakeVault.Close()
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	require.NoError(t, err, "failed to load AWS config ")
+	fakeSTS, awsCfg := ststest.FakeSTS(&awsCfg)
+	defer fakeSTS.Close()
+	proxyAddr, cleanup := startProxy(t, fakeVault.URL, awsCfg, internalconfig.CacheConfig{}, internalconfig.ProxyConfig{
+		Allow: []internalconfig.ProxyRule{{Pattern: "secret/data/*", Methods: []string{"GET"}}},
+		Deny:  internalconfig.DefaultProxyDenyRules,
+	})
+	defer cleanup()
+	fakeVaultResponse = vaultResponseFooBar
+
+	t.Run("allowed", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		resp, err := http.Get(fmt.Sprintf("http://%s/v1/secret/data/foo", proxyAddr))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NotEmpty(t, vaultRequests)
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		for _, req := range []struct {
+			method string
+			path   string
+		}{
+			{http.MethodPost, "/v1/secret/data/foo"},
+			{http.MethodGet, "/v1/secret/metadata/foo"},
+			{http.MethodPost, "/v1/auth/token/create"},
+			{http.MethodGet, "/v1/sys/mounts"},
+			{http.MethodPost, "/v1/team/auth/token/create"},
+		} {
+			vaultRequests = []*http.Request{}
+			r, err := http.NewRequest(req.method, fmt.Sprintf("http://%s%s", proxyAddr, req.path), nil)
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(r)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusForbidden, resp.StatusCode, req)
+			require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.JSONEq(t, `{"errors":["permission denied"]}`, string(body))
+			require.Empty(t, vaultRequests, "denied requests should not reach Vault")
+		}
+	})
+}
+
+func TestProxy_StreamingCache(t *testing.T) {
+	fakeVault := fakeVault()
+	defer fakeVault.Close()
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	require.NoError(t, err, "failed to load AWS config ")
+	fakeSTS, awsCfg := ststest.FakeSTS(&awsCfg)
+	defer fakeSTS.Close()
+	proxyAddr, cleanup := startProxy(t, fakeVault.URL, awsCfg, internalconfig.CacheConfig{
+		TTL:            time.Minute,
+		DefaultEnabled: true,
+		MaxEntrySize:   1024,
+	}, internalconfig.ProxyConfig{})
+	defer cleanup()
+
+	get := func(t *testing.T, path string) map[string]interface{} {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", proxyAddr, path))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var secret api.Secret
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&secret))
+		return secret.Data
+	}
+
+	t.Run("small response is cached", func(t *testing.T) {
+		fakeVaultResponse = vaultResponseFooBar
+		vaultRequests = []*http.Request{}
+		require.Equal(t, "bar", get(t, "/v1/secret/data/small")["foo"])
+		requests := len(vaultRequests)
+		require.Equal(t, "bar", get(t, "/v1/secret/data/small")["foo"])
+		require.Len(t, vaultRequests, requests)
+	})
+
+	t.Run("large response is streamed but not cached", func(t *testing.T) {
+		large := strings.Repeat("a", 4096)
+		fakeVaultResponse = vaultResponse{secret: &api.Secret{Data: map[string]interface{}{"foo": large}}}
+		vaultRequests = []*http.Request{}
+		require.Equal(t, large, get(t, "/v1/secret/data/large")["foo"])
+		requests := len(vaultRequests)
+		require.Equal(t, large, get(t, "/v1/secret/data/large")["foo"])
+		require.Len(t, vaultRequests, requests+1)
+	})
+}
+
+func TestProxy_CacheEviction(t *testing.T) {
+	fakeVault := fakeVault()
+	defer fakeVault.Close()
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	require.NoError(t, err, "failed to load AWS config ")
+	fakeSTS, awsCfg := ststest.FakeSTS(&awsCfg)
+	defer fakeSTS.Close()
+	proxyAddr, cleanup := startProxy(t, fakeVault.URL, awsCfg, internalconfig.CacheConfig{
+		TTL:            time.Minute,
+		DefaultEnabled: true,
+	}, internalconfig.ProxyConfig{})
+	defer cleanup()
+	fakeVaultResponse = vaultResponseFooBar
+
+	do := func(t *testing.T, method, path string, header http.Header) int {
+		t.Helper()
+		req, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", proxyAddr, path), nil)
+		require.NoError(t, err)
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+	// cached returns true if a GET of the path was served from the cache.
+	cached := func(t *testing.T, path string) bool {
+		t.Helper()
+		vaultRequests = []*http.Request{}
+		require.Equal(t, http.StatusOK, do(t, http.MethodGet, path, nil))
+		return len(vaultRequests) == 0
+	}
+
+	t.Run("write evicts cached reads of the same path", func(t *testing.T) {
+		require.False(t, cached(t, "/v1/secret/data/write"))
+		require.True(t, cached(t, "/v1/secret/data/write"))
+		require.False(t, cached(t, "/v1/secret/data/other"))
+
+		require.Equal(t, http.StatusOK, do(t, http.MethodPut, "/v1/secret/data/write", nil))
+		require.False(t, cached(t, "/v1/secret/data/write"))
+		require.True(t, cached(t, "/v1/secret/data/other"))
+	})
+
+	t.Run("KV v2 writes evict cached reads of the secret", func(t *testing.T) {
+		for _, write := range []struct {
+			method string
+			path   string
+		}{
+			{http.MethodDelete, "/v1/secret/metadata/kv"},
+			{http.MethodPost, "/v1/secret/destroy/kv"},
+			{http.MethodPost, "/v1/secret/delete/kv"},
+			{http.MethodPost, "/v1/secret/undelete/kv"},
+		} {
+			require.False(t, cached(t, "/v1/secret/data/kv"), write)
+			require.True(t, cached(t, "/v1/secret/data/kv"), write)
+			require.Equal(t, http.StatusOK, do(t, write.method, write.path, nil))
+			require.False(t, cached(t, "/v1/secret/data/kv"), write)
+			require.Equal(t, http.StatusOK, do(t, http.MethodDelete, "/v1/secret/data/kv", nil))
+		}
+	})
+
+	t.Run("writes evict cached reads in the same namespace", func(t *testing.T) {
+		cachedIn := func(t *testing.T, namespace, path string) bool {
+			t.Helper()
+			vaultRequests = []*http.Request{}
+			require.Equal(t, http.StatusOK, do(t, http.MethodGet, path, http.Header{
+				"X-Vault-Namespace": []string{namespace},
+			}))
+			return len(vaultRequests) == 0
+		}
+
+		require.False(t, cachedIn(t, "team", "/v1/secret/data/ns"))
+		require.True(t, cachedIn(t, "team", "/v1/secret/data/ns"))
+		require.False(t, cachedIn(t, "other", "/v1/secret/data/ns"))
+		require.False(t, cached(t, "/v1/secret/data/ns"))
+
+		require.Equal(t, http.StatusOK, do(t, http.MethodPut, "/v1/team/secret/data/ns", nil))
+		require.False(t, cachedIn(t, "team", "/v1/secret/data/ns"))
+		require.True(t, cachedIn(t, "other", "/v1/secret/data/ns"))
+		require.True(t, cached(t, "/v1/secret/data/ns"))
+	})
+
+	t.Run("failed write does not evict", func(t *testing.T) {
+		require.False(t, cached(t, "/v1/secret/data/failed"))
+		fakeVaultResponse = vaultResponse403
+		require.Equal(t, http.StatusForbidden, do(t, http.MethodDelete, "/v1/secret/data/failed", nil))
+		fakeVaultResponse = vaultResponseFooBar
+		require.True(t, cached(t, "/v1/secret/data/failed"))
+	})
+
+	t.Run("evict cache control option", func(t *testing.T) {
+		require.False(t, cached(t, "/v1/secret/data/header"))
+		require.True(t, cached(t, "/v1/secret/data/header"))
+		vaultRequests = []*http.Request{}
+		require.Equal(t, http.StatusOK, do(t, http.MethodGet, "/v1/secret/data/header", http.Header{
+			VaultCacheControlHeaderName: []string{"evict"},
+		}))
+		require.NotEmpty(t, vaultRequests)
+	})
+
+	t.Run("cache endpoint evicts a path", func(t *testing.T) {
+		require.False(t, cached(t, "/v1/secret/data/endpoint"))
+		require.True(t, cached(t, "/v1/secret/data/endpoint"))
+		require.True(t, cached(t, "/v1/secret/data/other"))
+
+		vaultRequests = []*http.Request{}
+		require.Equal(t, http.StatusNoContent, do(t, http.MethodDelete, CacheEndpointPath+"?path=secret/data/endpoint", nil))
+		require.Empty(t, vaultRequests, "cache endpoint should not be proxied")
+		require.False(t, cached(t, "/v1/secret/data/endpoint"))
+		require.True(t, cached(t, "/v1/secret/data/other"))
+	})
+
+	t.Run("cache endpoint evicts everything", func(t *testing.T) {
+		require.True(t, cached(t, "/v1/secret/data/other"))
+		require.Equal(t, http.StatusNoContent, do(t, http.MethodDelete, CacheEndpointPath, nil))
+		require.False(t, cached(t, "/v1/secret/data/other"))
+	})
+
+	t.Run("cache endpoint only allows DELETE", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		require.Equal(t, http.StatusMethodNotAllowed, do(t, http.MethodGet, CacheEndpointPath, nil))
+		require.Empty(t, vaultRequests)
+	})
+}
+
+func TestProxyRequest_Namespace(t *testing.T) {
+	for name, tc := range map[string]struct {
+		namespace       string
+		callerNamespace string
+		expected        string
+	}{
+		"no namespace":             {},
+		"default namespace":        {namespace: "ns1", expected: "ns1"},
+		"caller namespace":         {callerNamespace: "ns2", expected: "ns2"},
+		"caller overrides default": {namespace: "ns1", callerNamespace: "ns2", expected: "ns2"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/secret/data/foo", nil)
+			if tc.callerNamespace != "" {
+				r.Header.Set("X-Vault-Namespace", tc.callerNamespace)
+			}
+
+			fwReq, err := proxyRequest(r, "https://vault.example.com:8200", tc.namespace, "token")
+			require.NoError(t, err)
+			assert.Equal(t, "https://vault.example.com:8200/v1/secret/data/foo", fwReq.URL.String())
+			assert.Equal(t, tc.expected, fwReq.Header.Get("X-Vault-Namespace"))
+			assert.Equal(t, "token", fwReq.Header.Get("X-Vault-Token"))
+		})
+	}
+}
+
+func startProxy(t *testing.T, vaultAddress string, awsCfg aws.Config, cacheConfig internalconfig.CacheConfig, proxyConfig internalconfig.ProxyConfig) (string, func() error) {
 	vaultConfig := api.DefaultConfig()
 	require.NoError(t, vaultConfig.Error)
 	vaultConfig.Address = vaultAddress
@@ -167,7 +417,7 @@ func startProxy(t *testing.T, vaultAddress string, awsCfg aws.Config) (string, f
 	client.VaultConfig.Address = vaultAddress
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
-	proxy := New(hclog.NewNullLogger(), client, internalconfig.CacheConfig{})
+	proxy := New(hclog.NewNullLogger(), client, cacheConfig, proxyConfig)
 	go func() {
 		_ = proxy.Serve(ln)
 	}()
@@ -0,0 +1,236 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/hashicorp/vault/api"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the encoding used for a secret written to disk.
+type Format string
+
+const (
+	// FormatJSON is the full Vault response, including lease and auth
+	// information. This is the default when no format is given.
+	FormatJSON Format = "json"
+
+	// FormatJSONData is only the secret's data, unwrapped for KV v2.
+	FormatJSONData Format = "json-data"
+
+	// FormatDotenv writes one KEY="value" line per field of the data.
+	FormatDotenv Format = "dotenv"
+
+	// FormatYAML is the secret's data as a YAML document.
+	FormatYAML Format = "yaml"
+
+	// FormatProperties is the secret's data as a Java .properties file.
+	FormatProperties Format = "properties"
+
+	// FormatPKI splits a PKI issue or sign response into separate PEM files,
+	// written to the directory given as the secret's file path.
+	FormatPKI Format = "pki"
+
+	// formatRawPrefix precedes the name of a single field whose value is
+	// written byte-for-byte, e.g. "raw:private_key".
+	formatRawPrefix = "raw:"
+)
+
+var (
+	formats = map[Format]struct{}{
+		FormatJSON:       {},
+		FormatJSONData:   {},
+		FormatDotenv:     {},
+		FormatYAML:       {},
+		FormatProperties: {},
+		FormatPKI:        {},
+	}
+
+	dotenvKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+)
+
+// ParseFormat validates a format string. An empty string is the default
+// FormatJSON.
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.TrimSpace(s))
+	if f == "" {
+		return FormatJSON, nil
+	}
+	if field, ok := f.RawField(); ok {
+		if field == "" {
+			return "", fmt.Errorf("format %q must specify a field name", f)
+		}
+		return f, nil
+	}
+	if _, ok := formats[Format(strings.ToLower(string(f)))]; !ok {
+		return "", fmt.Errorf("unknown format %q; must be one of json, json-data, dotenv, yaml, properties, pki or raw:<field>", f)
+	}
+
+	return Format(strings.ToLower(string(f))), nil
+}
+
+// RawField returns the field name for a raw:<field> format.
+func (f Format) RawField() (string, bool) {
+	if !strings.HasPrefix(string(f), formatRawPrefix) {
+		return "", false
+	}
+
+	return string(f)[len(formatRawPrefix):], true
+}
+
+// Secret encodes the secret in the given format.
+func Secret(secret *api.Secret, f Format) ([]byte, error) {
+	if field, ok := f.RawField(); ok {
+		return raw(secret, field)
+	}
+
+	switch f {
+	case "", FormatJSON:
+		return json.MarshalIndent(secret, "", "  ")
+	case FormatJSONData:
+		return json.MarshalIndent(KVData(secret), "", "  ")
+	case FormatDotenv:
+		return dotenv(KVData(secret))
+	case FormatYAML:
+		data := KVData(secret)
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		return yaml.Marshal(normalizeNumbers(data))
+	case FormatProperties:
+		return properties(KVData(secret)), nil
+	case FormatPKI:
+		return nil, errors.New("the pki format writes multiple files and must be rendered with PKIFiles")
+	}
+
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+func raw(secret *api.Secret, field string) ([]byte, error) {
+	data := KVData(secret)
+	if data == nil {
+		return nil, fmt.Errorf("no data returned to read field %q from", field)
+	}
+	v, ok := data[field]
+	if !ok {
+		return nil, fmt.Errorf("field %q not found in secret data", field)
+	}
+
+	return []byte(toString(v)), nil
+}
+
+func dotenv(data map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, k := range sortedKeys(data) {
+		if !dotenvKeyRegexp.MatchString(k) {
+			return nil, fmt.Errorf("field %q is not a valid dotenv variable name", k)
+		}
+		fmt.Fprintf(&buf, "%s=\"%s\"\n", k, dotenvEscaper.Replace(toString(data[k])))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// dotenvEscaper escapes the characters that dotenv loaders decode inside a
+// double-quoted value. Unlike EnvEscape, $ and ` are left as-is, as loaders
+// don't unescape them.
+var dotenvEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+)
+
+func properties(data map[string]interface{}) []byte {
+	var buf bytes.Buffer
+	for _, k := range sortedKeys(data) {
+		buf.WriteString(escapeProperty(k, true))
+		buf.WriteByte('=')
+		buf.WriteString(escapeProperty(toString(data[k]), false))
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// escapeProperty escapes s as described by java.util.Properties#store, which
+// writes files using ISO 8859-1 and escapes everything else as \uXXXX.
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == ' ' && (isKey || i == 0):
+			b.WriteString(`\ `)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// normalizeNumbers converts json.Number values, which the Vault API client
+// uses for all numbers, so that they are encoded as numbers instead of strings.
+func normalizeNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return t.String()
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = normalizeNumbers(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = normalizeNumbers(v)
+		}
+		return s
+	}
+
+	return v
+}
+
+func sortedKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
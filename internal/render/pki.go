@@ -0,0 +1,107 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// PKI file names, written to the directory configured for the secret.
+const (
+	PKICertificateFile = "certificate.pem"
+	PKIPrivateKeyFile  = "private_key.pem"
+	PKIIssuingCAFile   = "issuing_ca.pem"
+	PKICAChainFile     = "ca_chain.pem"
+)
+
+// PKIFile is one of the PEM files written for a certificate issued by Vault's
+// PKI secrets engine.
+type PKIFile struct {
+	Name    string
+	Content []byte
+
+	// PrivateKey is true for the file holding the private key, which should
+	// have the most restrictive permissions.
+	PrivateKey bool
+}
+
+// PKIFiles splits a PKI issue or sign response into separate PEM files for the
+// certificate, private key, issuing CA and CA chain. Only the certificate is
+// required, and files are omitted for any other fields not in the response.
+func PKIFiles(secret *api.Secret) ([]PKIFile, error) {
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("no data returned to read certificate from")
+	}
+
+	certificate, ok := secret.Data["certificate"].(string)
+	if !ok || certificate == "" {
+		return nil, errors.New("field \"certificate\" not found in secret data")
+	}
+	files := []PKIFile{
+		{Name: PKICertificateFile, Content: pem(certificate)},
+	}
+
+	if privateKey, ok := secret.Data["private_key"].(string); ok && privateKey != "" {
+		files = append(files, PKIFile{Name: PKIPrivateKeyFile, Content: pem(privateKey), PrivateKey: true})
+	}
+	if issuingCA, ok := secret.Data["issuing_ca"].(string); ok && issuingCA != "" {
+		files = append(files, PKIFile{Name: PKIIssuingCAFile, Content: pem(issuingCA)})
+	}
+	if chain, ok := secret.Data["ca_chain"].([]interface{}); ok && len(chain) > 0 {
+		var content []byte
+		for _, c := range chain {
+			s, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("field \"ca_chain\" must be a list of strings, got %T", c)
+			}
+			content = append(content, pem(s)...)
+		}
+		files = append(files, PKIFile{Name: PKICAChainFile, Content: content})
+	}
+
+	return files, nil
+}
+
+// PKIExpiration returns the expiry time of the certificate in a PKI response,
+// read from the "expiration" field. It returns false if the field is missing.
+func PKIExpiration(secret *api.Secret) (time.Time, bool) {
+	if secret == nil || secret.Data == nil {
+		return time.Time{}, false
+	}
+
+	var expiration int64
+	switch t := secret.Data["expiration"].(type) {
+	case json.Number:
+		i, err := t.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		expiration = i
+	case float64:
+		expiration = int64(t)
+	case int64:
+		expiration = t
+	case int:
+		expiration = int64(t)
+	default:
+		return time.Time{}, false
+	}
+
+	return time.Unix(expiration, 0), true
+}
+
+// pem ensures a PEM block ends with a newline.
+func pem(s string) []byte {
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+
+	return []byte(s)
+}
@@ -0,0 +1,153 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// Package render converts secrets read from Vault into the content that is
+// written to disk in file mode.
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// funcMap holds the helper functions available to secret templates.
+var funcMap = template.FuncMap{
+	"kvData":       KVData,
+	"kvMetadata":   kvMetadata,
+	"base64Encode": base64Encode,
+	"base64Decode": base64Decode,
+	"toJSON":       toJSON,
+	"toJSONPretty": toJSONPretty,
+	"envEscape":    EnvEscape,
+}
+
+// ParseTemplate parses text as a Go text/template with the secret helper
+// functions available. Referencing a missing map key is an error at render
+// time rather than silently producing "<no value>".
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(funcMap).Option("missingkey=error").Parse(text)
+}
+
+// Template renders the template with the secret as its input.
+func Template(tmpl *template.Template, secret *api.Secret) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, secret); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// KVData returns the secret's data, unwrapping the inner "data" object of a
+// KV v2 read response. For any other response, including KV v1, the secret's
+// data is returned as-is.
+func KVData(secret *api.Secret) map[string]interface{} {
+	if secret == nil {
+		return nil
+	}
+	if data, ok := kvV2Field(secret, "data"); ok {
+		return data
+	}
+
+	return secret.Data
+}
+
+// kvMetadata returns the "metadata" object of a KV v2 read response, or nil
+// if the secret is not a KV v2 response.
+func kvMetadata(secret *api.Secret) map[string]interface{} {
+	if secret == nil {
+		return nil
+	}
+	metadata, _ := kvV2Field(secret, "metadata")
+
+	return metadata
+}
+
+// kvV2Field returns a top-level object from a KV v2 response, which always
+// has both a "data" and a "metadata" key.
+func kvV2Field(secret *api.Secret, key string) (map[string]interface{}, bool) {
+	if secret.Data == nil {
+		return nil, false
+	}
+	if _, ok := secret.Data["metadata"]; !ok {
+		return nil, false
+	}
+	if _, ok := secret.Data["data"]; !ok {
+		return nil, false
+	}
+	field, ok := secret.Data[key].(map[string]interface{})
+
+	return field, ok
+}
+
+func base64Encode(v interface{}) string {
+	return base64.StdEncoding.EncodeToString([]byte(toString(v)))
+}
+
+func base64Decode(v interface{}) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(toString(v))
+	if err != nil {
+		return "", err
+	}
+
+	return string(decoded), nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func toJSONPretty(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// envEscaper escapes the characters that are special inside a double-quoted
+// shell value. Newlines are left as-is, as the shell does not decode \n.
+var envEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"$", `\$`,
+	"`", "\\`",
+)
+
+// EnvEscape returns v as a double-quoted string that is safe to use as the
+// value in a shell variable assignment.
+func EnvEscape(v interface{}) string {
+	return `"` + envEscaper.Replace(toString(v)) + `"`
+}
+
+// toString converts a value from a secret's data into a string. Strings are
+// returned unmodified, and anything else is encoded as JSON.
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
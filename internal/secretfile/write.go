@@ -0,0 +1,126 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// Package secretfile writes secrets to disk for file mode.
+package secretfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// DefaultFileMode is used for secret files without a configured mode.
+	DefaultFileMode os.FileMode = 0600
+
+	// DefaultDirMode is used for directories created to hold secret files.
+	DefaultDirMode os.FileMode = 0700
+)
+
+// WriteFile atomically replaces the file at filePath with content, so readers
+// only ever see the old or the new file in full. The content is written to a
+// temporary file in the same directory, which is then renamed into place.
+// WriteFile refuses to write to a destination that is a symlink.
+func WriteFile(filePath string, content []byte, mode os.FileMode) error {
+	if mode == 0 {
+		mode = DefaultFileMode
+	}
+
+	fi, err := os.Lstat(filePath)
+	switch {
+	case err == nil && fi.Mode()&os.ModeSymlink != 0:
+		return fmt.Errorf("refusing to write to %q: destination is a symlink", filePath)
+	case err == nil && !fi.Mode().IsRegular():
+		return fmt.Errorf("refusing to write to %q: destination is not a regular file", filePath)
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("failed to check destination %q: %w", filePath, err)
+	}
+
+	dir, base := filepath.Split(filePath)
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %q: %w", filePath, err)
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		// Only exists if something went wrong before the rename.
+		_ = os.Remove(tmpName)
+	}()
+
+	if err := writeAndClose(tmp, content, mode); err != nil {
+		return fmt.Errorf("failed to write temporary file for %q: %w", filePath, err)
+	}
+	if err := os.Rename(tmpName, filePath); err != nil {
+		return fmt.Errorf("failed to move temporary file into place at %q: %w", filePath, err)
+	}
+
+	return nil
+}
+
+func writeAndClose(f *os.File, content []byte, mode os.FileMode) error {
+	// Set permissions before any content is written. Chmod is not subject to
+	// the umask, so the mode is applied exactly.
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// overwriteFile overwrites the content of the regular file at filePath with
+// zeros, without changing its size. It does not follow symlinks.
+func overwriteFile(filePath string) error {
+	fi, err := os.Lstat(filePath)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("refusing to overwrite %q: not a regular file", filePath)
+	}
+
+	f, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	zeros := make([]byte, 4096)
+	for remaining := fi.Size(); remaining > 0; {
+		n := int64(len(zeros))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := f.Write(zeros[:n]); err != nil {
+			_ = f.Close()
+			return err
+		}
+		remaining -= n
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// DirMode returns the mode for directories created to hold a file with the
+// given mode. Directories are private to the owner, except that traverse
+// permission is granted to the group or others if the file is readable by
+// them.
+func DirMode(fileMode os.FileMode) os.FileMode {
+	if fileMode == 0 {
+		fileMode = DefaultFileMode
+	}
+
+	return DefaultDirMode | (fileMode&0044)>>2
+}
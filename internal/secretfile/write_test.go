@@ -0,0 +1,99 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package secretfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	t.Run("default mode", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "secret.json")
+		require.NoError(t, WriteFile(filePath, []byte("foo"), 0))
+
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		require.Equal(t, "foo", string(content))
+		fi, err := os.Stat(filePath)
+		require.NoError(t, err)
+		require.Equal(t, DefaultFileMode, fi.Mode().Perm())
+	})
+
+	t.Run("overwrites existing file and applies mode", func(t *testing.T) {
+		dir := t.TempDir()
+		filePath := filepath.Join(dir, "secret.json")
+		require.NoError(t, os.WriteFile(filePath, []byte("old content"), 0644))
+		require.NoError(t, WriteFile(filePath, []byte("new"), 0640))
+
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		require.Equal(t, "new", string(content))
+		fi, err := os.Stat(filePath)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+		// No temporary files are left behind.
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("refuses to write through a symlink", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "target")
+		require.NoError(t, os.WriteFile(target, []byte("target"), 0600))
+		link := filepath.Join(dir, "secret.json")
+		require.NoError(t, os.Symlink(target, link))
+
+		err := WriteFile(link, []byte("foo"), 0)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "symlink")
+
+		content, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, "target", string(content))
+	})
+
+	t.Run("refuses to replace a directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.Error(t, WriteFile(dir, []byte("foo"), 0))
+	})
+}
+
+func TestDirMode(t *testing.T) {
+	for _, tc := range []struct {
+		fileMode os.FileMode
+		expected os.FileMode
+	}{
+		{0, 0700},
+		{0600, 0700},
+		{0400, 0700},
+		{0640, 0710},
+		{0644, 0711},
+		{0604, 0701},
+	} {
+		require.Equal(t, tc.expected, DirMode(tc.fileMode), "file mode %o", tc.fileMode)
+	}
+}
+
+func TestOverwriteFile(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "secret.json")
+	content := strings.Repeat("secret", 1000)
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+	require.NoError(t, overwriteFile(filePath))
+
+	actual, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, len(content)), actual)
+
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(filePath, link))
+	require.Error(t, overwriteFile(link))
+}
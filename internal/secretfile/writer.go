@@ -0,0 +1,465 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package secretfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+	"github.com/hashicorp/vault-lambda-extension/internal/render"
+	"github.com/hashicorp/vault-lambda-extension/internal/vault"
+)
+
+// Writer reads the configured secrets from Vault and writes them to disk. It
+// keeps track of each secret it has written so that secrets with a lease can
+// be renewed or refreshed before they expire, and revoked on shutdown.
+type Writer struct {
+	logger  hclog.Logger
+	client  *vault.Client
+	secrets []config.ConfiguredSecret
+	config  config.SecretFileConfig
+
+	written []*writtenSecret
+
+	// files and dirs are every file written and directory created, so they
+	// can be removed on shutdown. superseded are the leases of secrets that
+	// have since been read again, which are left to expire but still revoked
+	// on shutdown.
+	mtx        sync.Mutex
+	files      map[string]struct{}
+	dirs       []string
+	superseded []string
+}
+
+// writtenSecret is a secret that has been written to disk.
+type writtenSecret struct {
+	config.ConfiguredSecret
+
+	// fetched is when the secret was read or its lease last renewed, and ttl
+	// is the lease duration from that time.
+	fetched   time.Time
+	ttl       time.Duration
+	leaseID   string
+	renewable bool
+}
+
+// NewWriter returns a Writer for the given secrets. No secrets are read until
+// WriteAll is called.
+func NewWriter(logger hclog.Logger, client *vault.Client, secrets []config.ConfiguredSecret, cfg config.SecretFileConfig) *Writer {
+	return &Writer{
+		logger:  logger,
+		client:  client,
+		secrets: secrets,
+		config:  cfg,
+		files:   make(map[string]struct{}),
+	}
+}
+
+// WriteAll reads every configured secret from Vault and writes it to disk,
+// reading up to the configured concurrency limit of secrets in parallel. It
+// uses the Vault client as-is, including any request callbacks, and expects it
+// to already hold a valid token. Errors for all secrets are returned together.
+func (w *Writer) WriteAll(ctx context.Context) error {
+	start := time.Now()
+	w.logger.Debug("writing secrets to disk")
+
+	concurrency := w.config.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	var resultErr error
+	written := make([]*writtenSecret, len(w.secrets))
+	for i, s := range w.secrets {
+		wg.Add(1)
+		go func(i int, ws *writtenSecret) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := w.write(ctx, ws); err != nil {
+				mtx.Lock()
+				resultErr = multierror.Append(resultErr, err)
+				mtx.Unlock()
+				return
+			}
+			written[i] = ws
+		}(i, &writtenSecret{ConfiguredSecret: s})
+	}
+	wg.Wait()
+
+	// Keep the configured order, skipping any secrets that failed.
+	for _, ws := range written {
+		if ws != nil {
+			w.written = append(w.written, ws)
+		}
+	}
+	if resultErr != nil {
+		return resultErr
+	}
+
+	w.logger.Debug(fmt.Sprintf("wrote secrets to disk in %v", time.Since(start)))
+	return nil
+}
+
+// Refresh handles every secret that is past the configured fraction of its
+// lease duration, or of its certificate's lifetime in the pki format.
+// Renewable leases are renewed, and the secret's file is left as-is. If a
+// lease is not renewable, fails to renew, or has reached its maximum TTL, the
+// secret is read again and its file rewritten. Secrets without a lease or
+// expiry are never refreshed. A secret that fails to refresh keeps
+// its existing file, and is tried again on the next call.
+func (w *Writer) Refresh(ctx context.Context) error {
+	now := time.Now().Round(0)
+	var due []*writtenSecret
+	for _, ws := range w.written {
+		if ws.shouldRefresh(now, w.config.RefreshFraction) {
+			due = append(due, ws)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	// Renews or re-authenticates the client's token if required.
+	if _, err := w.client.Token(ctx); err != nil {
+		return fmt.Errorf("failed to get valid Vault token to refresh secrets: %w", err)
+	}
+
+	var resultErr error
+	for _, ws := range due {
+		if ws.renewable && ws.leaseID != "" {
+			renewed, err := w.renew(ctx, ws)
+			if err != nil {
+				w.logger.Warn("Failed to renew lease, reading secret again", "name", ws.Name(), "error", err)
+			} else if renewed {
+				w.logger.Debug("Renewed lease", "name", ws.Name(), "ttl", ws.ttl)
+				continue
+			}
+		}
+
+		if err := w.write(ctx, ws); err != nil {
+			resultErr = multierror.Append(resultErr, err)
+			continue
+		}
+		w.logger.Info("Refreshed secret", "name", ws.Name(), "file", ws.FilePath, "ttl", ws.ttl)
+	}
+
+	return resultErr
+}
+
+// renew renews the secret's lease by its original duration. It returns false
+// without an error if Vault capped the renewal, which means the lease is
+// approaching its maximum TTL and the secret should be read again instead.
+func (w *Writer) renew(ctx context.Context, ws *writtenSecret) (bool, error) {
+	secret, err := w.client.VaultClient.Sys().RenewWithContext(ctx, ws.leaseID, int(ws.ttl.Seconds()))
+	if err != nil {
+		return false, err
+	}
+	renewedTTL := leaseTTL(secret)
+	if renewedTTL < ws.ttl {
+		w.logger.Debug("Lease renewal was capped by its maximum TTL", "name", ws.Name(), "ttl", renewedTTL)
+		return false, nil
+	}
+
+	ws.fetched = time.Now().Round(0)
+	ws.ttl = renewedTTL
+	return true, nil
+}
+
+// RevokeLeases revokes the lease of every secret written, including leases
+// superseded by reading a secret again, so that dynamic credentials do not
+// outlive the execution environment. It is best effort: failures are logged,
+// and it gives up on any remaining leases once the context is done.
+func (w *Writer) RevokeLeases(ctx context.Context) {
+	var leased []*writtenSecret
+	for _, ws := range w.written {
+		if ws.leaseID != "" {
+			leased = append(leased, ws)
+		}
+	}
+	w.mtx.Lock()
+	superseded := w.superseded
+	w.mtx.Unlock()
+	total := len(leased) + len(superseded)
+	if total == 0 {
+		return
+	}
+
+	if _, err := w.client.Token(ctx); err != nil {
+		w.logger.Error("Failed to get valid Vault token to revoke leases", "error", err)
+		return
+	}
+
+	revoked := 0
+	for _, ws := range leased {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := w.client.VaultClient.Sys().RevokeWithContext(ctx, ws.leaseID); err != nil {
+			w.logger.Warn("Failed to revoke lease", "name", ws.Name(), "error", err)
+			continue
+		}
+		ws.leaseID = ""
+		revoked++
+	}
+
+	var remaining []string
+	for i, leaseID := range superseded {
+		if ctx.Err() != nil {
+			remaining = append(remaining, superseded[i:]...)
+			break
+		}
+		if err := w.client.VaultClient.Sys().RevokeWithContext(ctx, leaseID); err != nil {
+			w.logger.Warn("Failed to revoke superseded lease", "error", err)
+			remaining = append(remaining, leaseID)
+			continue
+		}
+		revoked++
+	}
+	w.mtx.Lock()
+	w.superseded = remaining
+	w.mtx.Unlock()
+
+	w.logger.Info(fmt.Sprintf("Revoked %d of %d leases", revoked, total))
+}
+
+// RemoveFiles removes every file written, overwriting each with zeros first if
+// configured, then removes the directories created to hold them. It is best
+// effort: failures are logged, and directories that are no longer empty are
+// left in place.
+func (w *Writer) RemoveFiles() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	files := make([]string, 0, len(w.files))
+	for f := range w.files {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	filesRemoved := 0
+	for _, f := range files {
+		if w.config.OverwriteOnShutdown {
+			if err := overwriteFile(f); err != nil {
+				w.logger.Warn("Failed to overwrite secret file", "file", f, "error", err)
+			}
+		}
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			w.logger.Warn("Failed to remove secret file", "file", f, "error", err)
+			continue
+		}
+		delete(w.files, f)
+		filesRemoved++
+	}
+
+	// A child directory's path is always longer than its parent's, so this
+	// removes the deepest directories first.
+	sort.Slice(w.dirs, func(i, j int) bool { return len(w.dirs[i]) > len(w.dirs[j]) })
+	var remaining []string
+	for _, d := range w.dirs {
+		if err := os.Remove(d); err != nil && !errors.Is(err, os.ErrNotExist) {
+			w.logger.Debug("Failed to remove directory", "dir", d, "error", err)
+			remaining = append(remaining, d)
+		}
+	}
+	dirsRemoved := len(w.dirs) - len(remaining)
+
+	w.logger.Info(fmt.Sprintf("Removed %d of %d secret files and %d of %d directories", filesRemoved, len(files), dirsRemoved, len(w.dirs)))
+	w.dirs = remaining
+}
+
+// mkdirAll creates dir and any missing parents, recording each directory it
+// creates.
+func (w *Writer) mkdirAll(dir string, mode os.FileMode) error {
+	var missing []string
+	for d := dir; ; d = path.Dir(d) {
+		_, err := os.Stat(d)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		missing = append(missing, d)
+		if path.Dir(d) == d {
+			break
+		}
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		err := os.Mkdir(missing[i], mode)
+		if errors.Is(err, os.ErrExist) {
+			// Created by another secret being written in parallel.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		w.mtx.Lock()
+		w.dirs = append(w.dirs, missing[i])
+		w.mtx.Unlock()
+	}
+
+	return nil
+}
+
+// write reads the secret from Vault, renders it and writes it to disk, then
+// records when it was fetched and for how long it is valid.
+func (w *Writer) write(ctx context.Context, ws *writtenSecret) error {
+	// Will block until shutdown event is received or cancelled via the context.
+	var secret *api.Secret
+	var err error
+	if ws.IsWrite() {
+		secret, err = w.client.VaultClient.Logical().WriteWithContext(ctx, ws.VaultPath, ws.Data)
+	} else {
+		secret, err = w.client.VaultClient.Logical().ReadWithContext(ctx, ws.VaultPath)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading secret %s: %w", ws.Name(), err)
+	}
+	fetched := time.Now().Round(0)
+
+	files, err := ws.render(secret)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		dir := path.Dir(f.path)
+		if err := w.mkdirAll(dir, DirMode(ws.Mode)); err != nil {
+			return fmt.Errorf("failed to create directory %q for secret %s: %s", dir, ws.Name(), err)
+		}
+
+		if err := WriteFile(f.path, f.content, f.mode); err != nil {
+			return fmt.Errorf("error writing file for secret %s: %w", ws.Name(), err)
+		}
+		w.mtx.Lock()
+		w.files[f.path] = struct{}{}
+		w.mtx.Unlock()
+	}
+
+	// The previous lease is no longer renewed, but credentials from it may
+	// still be in use, so it is only revoked on shutdown.
+	if ws.leaseID != "" && (secret == nil || secret.LeaseID != ws.leaseID) {
+		w.mtx.Lock()
+		w.superseded = append(w.superseded, ws.leaseID)
+		w.mtx.Unlock()
+	}
+
+	ws.fetched = fetched
+	ws.ttl = ws.validFor(secret, fetched)
+	ws.leaseID = ""
+	ws.renewable = false
+	if secret != nil {
+		ws.leaseID = secret.LeaseID
+		ws.renewable = secret.Renewable
+	}
+	return nil
+}
+
+// outputFile is a file to write for a secret.
+type outputFile struct {
+	path    string
+	content []byte
+	mode    os.FileMode
+}
+
+// render returns the files to write for the secret. The pki format writes
+// several files to the directory at FilePath, and every other format writes a
+// single file to FilePath.
+func (ws *writtenSecret) render(secret *api.Secret) ([]outputFile, error) {
+	if ws.Template != nil {
+		content, err := render.Template(ws.Template, secret)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering secret %s: %w", ws.Name(), err)
+		}
+		return []outputFile{{path: ws.FilePath, content: content, mode: ws.Mode}}, nil
+	}
+
+	if ws.Format != render.FormatPKI {
+		content, err := render.Secret(secret, ws.Format)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding secret %s: %w", ws.Name(), err)
+		}
+		return []outputFile{{path: ws.FilePath, content: content, mode: ws.Mode}}, nil
+	}
+
+	pkiFiles, err := render.PKIFiles(secret)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding certificate for secret %s: %w", ws.Name(), err)
+	}
+	files := make([]outputFile, 0, len(pkiFiles))
+	for _, f := range pkiFiles {
+		mode := ws.Mode
+		if f.PrivateKey {
+			mode = privateKeyMode(mode)
+		}
+		files = append(files, outputFile{path: path.Join(ws.FilePath, f.Name), content: f.Content, mode: mode})
+	}
+
+	return files, nil
+}
+
+// validFor returns how long the secret is valid for from when it was fetched,
+// or 0 if it does not expire. For certificates written in the pki format
+// without a lease, this is the time until the certificate expires.
+func (ws *writtenSecret) validFor(secret *api.Secret, fetched time.Time) time.Duration {
+	if ttl := leaseTTL(secret); ttl > 0 || ws.Format != render.FormatPKI {
+		return ttl
+	}
+	expiration, ok := render.PKIExpiration(secret)
+	if !ok || !expiration.After(fetched) {
+		return 0
+	}
+
+	return expiration.Sub(fetched)
+}
+
+// privateKeyMode restricts the mode of a private key file to at most owner
+// read and write, regardless of the mode configured for the certificates.
+func privateKeyMode(mode os.FileMode) os.FileMode {
+	if mode == 0 {
+		return DefaultFileMode
+	}
+	if keyMode := mode & 0600; keyMode != 0 {
+		return keyMode
+	}
+
+	return DefaultFileMode
+}
+
+// shouldRefresh returns true if the secret has a lease and more than the
+// given fraction of it has elapsed.
+func (ws *writtenSecret) shouldRefresh(now time.Time, fraction float64) bool {
+	if ws.ttl <= 0 {
+		return false
+	}
+	refreshAt := ws.fetched.Add(time.Duration(float64(ws.ttl) * fraction))
+
+	return !now.Before(refreshAt)
+}
+
+// leaseTTL returns how long the secret is valid for, or 0 if it does not
+// expire.
+func leaseTTL(secret *api.Secret) time.Duration {
+	if secret == nil {
+		return 0
+	}
+
+	return time.Duration(secret.LeaseDuration) * time.Second
+}
@@ -0,0 +1,461 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package secretfile
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+	"github.com/hashicorp/vault-lambda-extension/internal/render"
+	"github.com/hashicorp/vault-lambda-extension/internal/ststest"
+	"github.com/hashicorp/vault-lambda-extension/internal/vault"
+)
+
+// fakeVault serves logins and returns the secret from secretFunc for any
+// other request. Requests to paths ending in "/fail" get an error response.
+type fakeVault struct {
+	*httptest.Server
+
+	mtx        sync.Mutex
+	requests   []*http.Request
+	secretFunc func(r *http.Request) *api.Secret
+}
+
+func newFakeVault(t *testing.T, secretFunc func(r *http.Request) *api.Secret) *fakeVault {
+	t.Helper()
+	fv := &fakeVault{secretFunc: secretFunc}
+	fv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fv.mtx.Lock()
+		fv.requests = append(fv.requests, r)
+		fv.mtx.Unlock()
+
+		secret := &api.Secret{
+			Auth: &api.SecretAuth{
+				LeaseDuration: 3600,
+				ClientToken:   "foo",
+				Renewable:     true,
+			},
+		}
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			http.Error(w, `{"errors":["failed"]}`, http.StatusBadRequest)
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, "/login") {
+			secret = fv.secretFunc(r)
+		}
+		if secret == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		b, err := json.Marshal(secret)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(fv.Close)
+
+	return fv
+}
+
+func (fv *fakeVault) reset() {
+	fv.mtx.Lock()
+	defer fv.mtx.Unlock()
+	fv.requests = nil
+}
+
+// paths returns the paths of every request received, excluding logins.
+func (fv *fakeVault) paths() []string {
+	fv.mtx.Lock()
+	defer fv.mtx.Unlock()
+	var paths []string
+	for _, r := range fv.requests {
+		if !strings.HasSuffix(r.URL.Path, "/login") {
+			paths = append(paths, r.URL.Path)
+		}
+	}
+
+	return paths
+}
+
+func newTestClient(t *testing.T, vaultAddress string) *vault.Client {
+	t.Helper()
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	require.NoError(t, err)
+	stsServer, awsCfg := ststest.FakeSTS(&awsCfg)
+	t.Cleanup(stsServer.Close)
+
+	vaultConfig := api.DefaultConfig()
+	require.NoError(t, vaultConfig.Error)
+	vaultConfig.Address = vaultAddress
+	client, err := vault.NewClient("", "", hclog.NewNullLogger(), vaultConfig, config.AuthConfig{
+		Provider: "aws",
+		Role:     "test-role",
+	}, awsCfg)
+	require.NoError(t, err)
+	_, err = client.Token(context.Background())
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	fv := newFakeVault(t, func(r *http.Request) *api.Secret {
+		switch r.URL.Path {
+		case "/v1/database/creds/foo":
+			return &api.Secret{
+				LeaseID:       "database/creds/foo/1",
+				LeaseDuration: 3600,
+				Data:          map[string]interface{}{"username": "foo", "password": "bar"},
+			}
+		default:
+			return &api.Secret{
+				Data: map[string]interface{}{"foo": "bar"},
+			}
+		}
+	})
+	client := newTestClient(t, fv.URL)
+
+	w := NewWriter(hclog.NewNullLogger(), client, []config.ConfiguredSecret{
+		{VaultPath: "database/creds/foo", FilePath: filepath.Join(dir, "nested", "db.json")},
+		{VaultPath: "secret/foo", FilePath: filepath.Join(dir, "kv.json")},
+	}, config.SecretFileConfig{RefreshFraction: 0.8})
+	require.NoError(t, w.WriteAll(context.Background()))
+	require.ElementsMatch(t, []string{"/v1/database/creds/foo", "/v1/secret/foo"}, fv.paths())
+
+	content, err := os.ReadFile(filepath.Join(dir, "nested", "db.json"))
+	require.NoError(t, err)
+	var secret api.Secret
+	require.NoError(t, json.Unmarshal(content, &secret))
+	require.Equal(t, "bar", secret.Data["password"])
+
+	fi, err := os.Stat(filepath.Join(dir, "nested"))
+	require.NoError(t, err)
+	require.Equal(t, DefaultDirMode, fi.Mode().Perm())
+
+	t.Run("nothing to refresh", func(t *testing.T) {
+		fv.reset()
+		require.NoError(t, w.Refresh(context.Background()))
+		require.Empty(t, fv.paths())
+	})
+
+	t.Run("refreshes secrets past the refresh fraction of their lease", func(t *testing.T) {
+		fv.reset()
+		// Pretend the lease was issued 50 minutes ago.
+		w.written[0].fetched = time.Now().Add(-50 * time.Minute)
+		w.written[1].fetched = time.Now().Add(-50 * time.Minute)
+
+		require.NoError(t, w.Refresh(context.Background()))
+		require.Equal(t, []string{"/v1/database/creds/foo"}, fv.paths())
+		require.WithinDuration(t, time.Now(), w.written[0].fetched, time.Minute)
+	})
+}
+
+func TestWriter_WriteMethod(t *testing.T) {
+	dir := t.TempDir()
+	var body map[string]interface{}
+	fv := newFakeVault(t, func(r *http.Request) *api.Secret {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil
+		}
+		return &api.Secret{
+			Data: map[string]interface{}{"certificate": "cert"},
+		}
+	})
+	client := newTestClient(t, fv.URL)
+
+	w := NewWriter(hclog.NewNullLogger(), client, []config.ConfiguredSecret{
+		{
+			VaultPath: "pki/issue/foo",
+			FilePath:  filepath.Join(dir, "cert.pem"),
+			Format:    "raw:certificate",
+			Method:    http.MethodPost,
+			Data:      map[string]interface{}{"common_name": "foo.example.com"},
+		},
+	}, config.SecretFileConfig{})
+	require.NoError(t, w.WriteAll(context.Background()))
+
+	require.Equal(t, []string{"/v1/pki/issue/foo"}, fv.paths())
+	require.Equal(t, http.MethodPut, fv.requests[len(fv.requests)-1].Method)
+	require.Equal(t, map[string]interface{}{"common_name": "foo.example.com"}, body)
+	content, err := os.ReadFile(filepath.Join(dir, "cert.pem"))
+	require.NoError(t, err)
+	require.Equal(t, "cert", string(content))
+}
+
+func TestWriter_PKI(t *testing.T) {
+	dir := t.TempDir()
+	var expiration int64
+	fv := newFakeVault(t, func(r *http.Request) *api.Secret {
+		expiration = time.Now().Add(time.Hour).Unix()
+		return &api.Secret{
+			Data: map[string]interface{}{
+				"certificate": "cert",
+				"private_key": "key",
+				"issuing_ca":  "ca",
+				"ca_chain":    []interface{}{"ca", "root"},
+				"expiration":  expiration,
+			},
+		}
+	})
+	client := newTestClient(t, fv.URL)
+
+	certDir := filepath.Join(dir, "tls")
+	w := NewWriter(hclog.NewNullLogger(), client, []config.ConfiguredSecret{
+		{
+			VaultPath: "pki/issue/foo",
+			FilePath:  certDir,
+			Format:    render.FormatPKI,
+			Mode:      0640,
+			Method:    http.MethodPost,
+			Data:      map[string]interface{}{"common_name": "foo.example.com"},
+		},
+	}, config.SecretFileConfig{RefreshFraction: 0.8})
+	require.NoError(t, w.WriteAll(context.Background()))
+
+	for name, expected := range map[string]struct {
+		content string
+		mode    os.FileMode
+	}{
+		render.PKICertificateFile: {"cert\n", 0640},
+		render.PKIPrivateKeyFile:  {"key\n", 0600},
+		render.PKIIssuingCAFile:   {"ca\n", 0640},
+		render.PKICAChainFile:     {"ca\nroot\n", 0640},
+	} {
+		content, err := os.ReadFile(filepath.Join(certDir, name))
+		require.NoError(t, err, name)
+		require.Equal(t, expected.content, string(content), name)
+		fi, err := os.Stat(filepath.Join(certDir, name))
+		require.NoError(t, err, name)
+		require.Equal(t, expected.mode, fi.Mode().Perm(), name)
+	}
+	fi, err := os.Stat(certDir)
+	require.NoError(t, err)
+	require.Equal(t, DirMode(0640), fi.Mode().Perm())
+
+	// Without a lease, the certificate's expiration determines when it is
+	// issued again.
+	require.InDelta(t, time.Hour.Seconds(), w.written[0].ttl.Seconds(), 5)
+
+	fv.reset()
+	require.NoError(t, w.Refresh(context.Background()))
+	require.Empty(t, fv.paths())
+
+	w.written[0].fetched = time.Now().Add(-50 * time.Minute)
+	require.NoError(t, w.Refresh(context.Background()))
+	require.Equal(t, []string{"/v1/pki/issue/foo"}, fv.paths())
+	require.WithinDuration(t, time.Now(), w.written[0].fetched, time.Minute)
+}
+
+func TestWriter_WriteAllConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	var mtx sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	fv := newFakeVault(t, func(r *http.Request) *api.Secret {
+		mtx.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mtx.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mtx.Lock()
+		inFlight--
+		mtx.Unlock()
+
+		return &api.Secret{
+			Data: map[string]interface{}{"path": r.URL.Path},
+		}
+	})
+	client := newTestClient(t, fv.URL)
+	client.VaultClient = client.VaultClient.WithRequestCallbacks(api.RequireState("test-state"))
+
+	var secrets []config.ConfiguredSecret
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		secrets = append(secrets, config.ConfiguredSecret{
+			VaultPath: "secret/" + name,
+			FilePath:  filepath.Join(dir, name+".json"),
+		})
+	}
+
+	t.Run("reads are bounded by the concurrency limit", func(t *testing.T) {
+		fv.reset()
+		w := NewWriter(hclog.NewNullLogger(), client, secrets, config.SecretFileConfig{Concurrency: 2})
+		require.NoError(t, w.WriteAll(context.Background()))
+		require.Len(t, fv.paths(), len(secrets))
+		require.Equal(t, 2, maxInFlight)
+
+		// Secrets are tracked in the configured order.
+		require.Len(t, w.written, len(secrets))
+		for i, ws := range w.written {
+			require.Equal(t, secrets[i].VaultPath, ws.VaultPath)
+		}
+
+		// Request callbacks apply to every request.
+		for _, r := range fv.requests {
+			require.Equal(t, "test-state", r.Header.Get(api.HeaderIndex))
+		}
+	})
+
+	t.Run("errors are aggregated", func(t *testing.T) {
+		fv.reset()
+		failing := append([]config.ConfiguredSecret{
+			{VaultPath: "secret/one/fail", FilePath: filepath.Join(dir, "one.json")},
+			{VaultPath: "secret/two/fail", FilePath: filepath.Join(dir, "two.json")},
+		}, secrets...)
+		w := NewWriter(hclog.NewNullLogger(), client, failing, config.SecretFileConfig{Concurrency: 4})
+		err := w.WriteAll(context.Background())
+		require.Error(t, err)
+		merr, ok := err.(*multierror.Error)
+		require.True(t, ok)
+		require.Len(t, merr.Errors, 2)
+		require.Len(t, w.written, len(secrets))
+	})
+}
+
+func TestWriter_Leases(t *testing.T) {
+	dir := t.TempDir()
+	renewedDuration := 3600
+	leaseID := "database/creds/foo/1"
+	var revoked []string
+	fv := newFakeVault(t, func(r *http.Request) *api.Secret {
+		switch r.URL.Path {
+		case "/v1/sys/leases/renew":
+			return &api.Secret{
+				LeaseID:       leaseID,
+				LeaseDuration: renewedDuration,
+				Renewable:     true,
+			}
+		case "/v1/sys/leases/revoke":
+			var body struct {
+				LeaseID string `json:"lease_id"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			revoked = append(revoked, body.LeaseID)
+			return &api.Secret{}
+		default:
+			return &api.Secret{
+				LeaseID:       leaseID,
+				LeaseDuration: 3600,
+				Renewable:     true,
+				Data:          map[string]interface{}{"username": "foo", "password": "bar"},
+			}
+		}
+	})
+	client := newTestClient(t, fv.URL)
+
+	w := NewWriter(hclog.NewNullLogger(), client, []config.ConfiguredSecret{
+		{VaultPath: "database/creds/foo", FilePath: filepath.Join(dir, "db.json")},
+	}, config.SecretFileConfig{RefreshFraction: 0.8})
+	require.NoError(t, w.WriteAll(context.Background()))
+	require.Equal(t, "database/creds/foo/1", w.written[0].leaseID)
+	require.True(t, w.written[0].renewable)
+
+	t.Run("renews renewable leases without rewriting", func(t *testing.T) {
+		fv.reset()
+		w.written[0].fetched = time.Now().Add(-50 * time.Minute)
+
+		require.NoError(t, w.Refresh(context.Background()))
+		require.Equal(t, []string{"/v1/sys/leases/renew"}, fv.paths())
+		require.WithinDuration(t, time.Now(), w.written[0].fetched, time.Minute)
+	})
+
+	t.Run("reads secret again when renewal is capped", func(t *testing.T) {
+		fv.reset()
+		renewedDuration = 60
+		w.written[0].fetched = time.Now().Add(-50 * time.Minute)
+		leaseID = "database/creds/foo/2"
+
+		require.NoError(t, w.Refresh(context.Background()))
+		require.Equal(t, []string{"/v1/sys/leases/renew", "/v1/database/creds/foo"}, fv.paths())
+		require.Equal(t, time.Hour, w.written[0].ttl)
+		require.Equal(t, "database/creds/foo/2", w.written[0].leaseID)
+		require.Equal(t, []string{"database/creds/foo/1"}, w.superseded)
+	})
+
+	t.Run("revokes leases", func(t *testing.T) {
+		fv.reset()
+		w.RevokeLeases(context.Background())
+		require.Equal(t, []string{"/v1/sys/leases/revoke", "/v1/sys/leases/revoke"}, fv.paths())
+		require.Equal(t, []string{"database/creds/foo/2", "database/creds/foo/1"}, revoked)
+		require.Empty(t, w.written[0].leaseID)
+		require.Empty(t, w.superseded)
+
+		// Already revoked leases are not revoked again.
+		fv.reset()
+		w.RevokeLeases(context.Background())
+		require.Empty(t, fv.paths())
+	})
+}
+
+func TestWriter_RemoveFiles(t *testing.T) {
+	for _, overwrite := range []bool{false, true} {
+		dir := t.TempDir()
+		fv := newFakeVault(t, func(r *http.Request) *api.Secret {
+			return &api.Secret{
+				Data: map[string]interface{}{"certificate": "cert", "private_key": "key"},
+			}
+		})
+		client := newTestClient(t, fv.URL)
+
+		// An existing file in the directory shared with the function is kept.
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0600))
+		w := NewWriter(hclog.NewNullLogger(), client, []config.ConfiguredSecret{
+			{VaultPath: "secret/foo", FilePath: filepath.Join(dir, "foo.json")},
+			{VaultPath: "secret/bar", FilePath: filepath.Join(dir, "a", "b", "bar.json")},
+			{VaultPath: "pki/issue/foo", FilePath: filepath.Join(dir, "a", "tls"), Format: render.FormatPKI},
+		}, config.SecretFileConfig{OverwriteOnShutdown: overwrite})
+		require.NoError(t, w.WriteAll(context.Background()))
+		require.Len(t, w.files, 4)
+		require.ElementsMatch(t, []string{
+			filepath.Join(dir, "a"),
+			filepath.Join(dir, "a", "b"),
+			filepath.Join(dir, "a", "tls"),
+		}, w.dirs)
+
+		w.RemoveFiles()
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "overwrite %t", overwrite)
+		require.Equal(t, "other.txt", entries[0].Name())
+		require.Empty(t, w.files)
+		require.Empty(t, w.dirs)
+	}
+}
+
+func TestShouldRefresh(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name     string
+		fetched  time.Time
+		ttl      time.Duration
+		expected bool
+	}{
+		{"no lease", now.Add(-time.Hour), 0, false},
+		{"fresh lease", now, time.Hour, false},
+		{"before refresh fraction", now.Add(-47 * time.Minute), time.Hour, false},
+		{"after refresh fraction", now.Add(-49 * time.Minute), time.Hour, true},
+		{"expired", now.Add(-2 * time.Hour), time.Hour, true},
+	} {
+		ws := writtenSecret{fetched: tc.fetched, ttl: tc.ttl}
+		require.Equal(t, tc.expected, ws.shouldRefresh(now, 0.8), tc.name)
+	}
+}
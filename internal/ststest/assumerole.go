@@ -0,0 +1,103 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package ststest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// AssumeRoleRequest is an AssumeRole call received by FakeAssumeRoleSTS.
+type AssumeRoleRequest struct {
+	// Params are the call's form parameters, e.g. RoleArn and ExternalId.
+	Params url.Values
+
+	// AccessKeyID is the access key the call was signed with.
+	AccessKeyID string
+}
+
+// FakeAssumeRoleSTS is a fake STS server that answers AssumeRole calls with
+// new credentials and records every call it receives. The access key ID
+// returned by each call is "ASIA" followed by the number of the call, starting
+// at 1, so that chained calls can be traced.
+type FakeAssumeRoleSTS struct {
+	*httptest.Server
+
+	mtx      sync.Mutex
+	requests []AssumeRoleRequest
+}
+
+// NewFakeAssumeRoleSTS starts a FakeAssumeRoleSTS, and returns a copy of the
+// AWS config passed in configured to talk to it.
+func NewFakeAssumeRoleSTS(cfg *aws.Config) (*FakeAssumeRoleSTS, aws.Config) {
+	f := &FakeAssumeRoleSTS{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+
+	cpycfg := *cfg
+	cpycfg.BaseEndpoint = aws.String(f.URL)
+	cpycfg.Region = "us-east-1"
+	cpycfg.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider("foo", "foo", "foo"))
+
+	return f, cpycfg
+}
+
+// Requests returns every AssumeRole call received so far.
+func (f *FakeAssumeRoleSTS) Requests() []AssumeRoleRequest {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return append([]AssumeRoleRequest(nil), f.requests...)
+}
+
+func (f *FakeAssumeRoleSTS) handle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("Action") != "AssumeRole" {
+		http.Error(w, "unexpected STS action", http.StatusBadRequest)
+		return
+	}
+
+	f.mtx.Lock()
+	f.requests = append(f.requests, AssumeRoleRequest{
+		Params:      r.PostForm,
+		AccessKeyID: signingAccessKeyID(r.Header.Get("Authorization")),
+	})
+	n := len(f.requests)
+	f.mtx.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+	<AssumeRoleResult>
+		<Credentials>
+			<AccessKeyId>ASIA%d</AccessKeyId>
+			<SecretAccessKey>secret-%d</SecretAccessKey>
+			<SessionToken>session-token-%d</SessionToken>
+			<Expiration>2030-01-01T00:00:00Z</Expiration>
+		</Credentials>
+		<AssumedRoleUser>
+			<AssumedRoleId>AROAEXAMPLE:%s</AssumedRoleId>
+			<Arn>%s</Arn>
+		</AssumedRoleUser>
+	</AssumeRoleResult>
+	<ResponseMetadata>
+		<RequestId>request-%d</RequestId>
+	</ResponseMetadata>
+</AssumeRoleResponse>`, n, n, n, r.PostForm.Get("RoleSessionName"), r.PostForm.Get("RoleArn"), n)
+}
+
+// signingAccessKeyID reads the access key ID from a SigV4 Authorization header.
+func signingAccessKeyID(authorization string) string {
+	_, credential, ok := strings.Cut(authorization, "Credential=")
+	if !ok {
+		return ""
+	}
+	accessKeyID, _, _ := strings.Cut(credential, "/")
+
+	return accessKeyID
+}
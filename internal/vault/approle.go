@@ -0,0 +1,121 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+// appRoleAuthenticator logs in with the AppRole auth method. The secret ID is
+// read from the environment, read from a file on every login, or unwrapped
+// from a response-wrapping token on the first login.
+type appRoleAuthenticator struct {
+	logger     hclog.Logger
+	authConfig config.AuthConfig
+
+	// unwrappedSecretID caches the secret ID from the wrapping token, which
+	// can only be unwrapped once.
+	unwrappedSecretID string
+}
+
+func newAppRoleAuthenticator(logger hclog.Logger, authConfig config.AuthConfig) (*appRoleAuthenticator, error) {
+	if authConfig.AppRoleRoleID == "" {
+		return nil, errors.New("missing VAULT_APPROLE_ROLE_ID environment variable")
+	}
+	sources := 0
+	for _, s := range []string{authConfig.AppRoleSecretID, authConfig.AppRoleSecretIDFile, authConfig.AppRoleWrappedSecretID} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, errors.New("only one of VAULT_APPROLE_SECRET_ID, VAULT_APPROLE_SECRET_ID_FILE or VAULT_APPROLE_WRAPPED_SECRET_ID can be set")
+	}
+
+	return &appRoleAuthenticator{
+		logger:     logger,
+		authConfig: authConfig,
+	}, nil
+}
+
+// Login sends the role ID and secret ID to the AppRole auth method.
+func (a *appRoleAuthenticator) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	data := map[string]interface{}{
+		"role_id": a.authConfig.AppRoleRoleID,
+	}
+	secretID, err := a.secretID(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if secretID != "" {
+		data["secret_id"] = secretID
+	}
+
+	mount := a.authConfig.Mount()
+	secret, err := client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", mount), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with Vault AppRole auth method at %q: %w", mount, err)
+	}
+
+	return secret, nil
+}
+
+// secretID returns the secret ID from whichever source is configured, or an
+// empty string if none is, for roles that do not require one.
+func (a *appRoleAuthenticator) secretID(ctx context.Context, client *api.Client) (string, error) {
+	switch {
+	case a.authConfig.AppRoleSecretID != "":
+		return a.authConfig.AppRoleSecretID, nil
+	case a.authConfig.AppRoleSecretIDFile != "":
+		b, err := os.ReadFile(a.authConfig.AppRoleSecretIDFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read AppRole secret ID file: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	case a.authConfig.AppRoleWrappedSecretID != "":
+		if a.unwrappedSecretID == "" {
+			secretID, err := unwrapSecretID(ctx, client, a.authConfig.AppRoleWrappedSecretID)
+			if err != nil {
+				return "", err
+			}
+			a.logger.Debug("unwrapped AppRole secret ID")
+			a.unwrappedSecretID = secretID
+		}
+		return a.unwrappedSecretID, nil
+	}
+
+	return "", nil
+}
+
+// unwrapSecretID unwraps a response-wrapped secret ID, using a copy of the
+// client authenticated with the wrapping token itself.
+func unwrapSecretID(ctx context.Context, client *api.Client, wrappingToken string) (string, error) {
+	unwrapClient, err := cloneWithToken(client, wrappingToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to create client to unwrap AppRole secret ID: %w", err)
+	}
+
+	secret, err := unwrapClient.Logical().UnwrapWithContext(ctx, wrappingToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap AppRole secret ID: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return "", errors.New("failed to unwrap AppRole secret ID: no data in response")
+	}
+	secretID, ok := secret.Data["secret_id"].(string)
+	if !ok || secretID == "" {
+		return "", errors.New("failed to unwrap AppRole secret ID: no secret_id in response")
+	}
+
+	return secretID, nil
+}
@@ -0,0 +1,128 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+func TestNewAppRoleAuthenticator(t *testing.T) {
+	_, err := newAppRoleAuthenticator(hclog.NewNullLogger(), config.AuthConfig{Method: config.AuthMethodAppRole})
+	require.ErrorContains(t, err, "VAULT_APPROLE_ROLE_ID")
+
+	_, err = newAppRoleAuthenticator(hclog.NewNullLogger(), config.AuthConfig{
+		Method:              config.AuthMethodAppRole,
+		AppRoleRoleID:       "role-id",
+		AppRoleSecretID:     "secret-id",
+		AppRoleSecretIDFile: "/opt/secret-id",
+	})
+	require.ErrorContains(t, err, "only one of")
+}
+
+func TestAppRoleAuthenticator_Login(t *testing.T) {
+	vault := fakeVault()
+	defer vault.Close()
+
+	secretIDFile := filepath.Join(t.TempDir(), "secret-id")
+	require.NoError(t, os.WriteFile(secretIDFile, []byte("secret-id-from-file\n"), 0600))
+
+	for _, tc := range []struct {
+		name       string
+		authConfig config.AuthConfig
+		secrets    []*api.Secret
+		paths      []string
+		expected   map[string]interface{}
+	}{
+		{
+			name:       "secret ID from env",
+			authConfig: config.AuthConfig{AppRoleSecretID: "secret-id"},
+			secrets:    []*api.Secret{with1hLease},
+			paths:      []string{"/v1/auth/approle/login"},
+			expected:   map[string]interface{}{"role_id": "role-id", "secret_id": "secret-id"},
+		},
+		{
+			name:       "secret ID from file with custom mount",
+			authConfig: config.AuthConfig{Provider: "lambda-approle", AppRoleSecretIDFile: secretIDFile},
+			secrets:    []*api.Secret{with1hLease},
+			paths:      []string{"/v1/auth/lambda-approle/login"},
+			expected:   map[string]interface{}{"role_id": "role-id", "secret_id": "secret-id-from-file"},
+		},
+		{
+			name:       "wrapped secret ID",
+			authConfig: config.AuthConfig{AppRoleWrappedSecretID: "wrapping-token"},
+			secrets: []*api.Secret{
+				{Data: map[string]interface{}{"secret_id": "unwrapped-secret-id"}},
+				with1hLease,
+			},
+			paths:    []string{"/v1/sys/wrapping/unwrap", "/v1/auth/approle/login"},
+			expected: map[string]interface{}{"role_id": "role-id", "secret_id": "unwrapped-secret-id"},
+		},
+		{
+			name:       "no secret ID",
+			authConfig: config.AuthConfig{},
+			secrets:    []*api.Secret{with1hLease},
+			paths:      []string{"/v1/auth/approle/login"},
+			expected:   map[string]interface{}{"role_id": "role-id"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vaultRequests = []*http.Request{}
+			vaultRequestBodies = [][]byte{}
+			secretFunc = generateSecretFunc(t, tc.secrets)
+
+			vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+			require.NoError(t, err)
+			tc.authConfig.Method = config.AuthMethodAppRole
+			tc.authConfig.AppRoleRoleID = "role-id"
+			a, err := newAppRoleAuthenticator(hclog.NewNullLogger(), tc.authConfig)
+			require.NoError(t, err)
+
+			secret, err := a.Login(context.Background(), vaultClient)
+			require.NoError(t, err)
+			require.Equal(t, "foo-1h-token", secret.Auth.ClientToken)
+
+			var paths []string
+			for _, r := range vaultRequests {
+				paths = append(paths, r.URL.Path)
+			}
+			require.Equal(t, tc.paths, paths)
+			require.Equal(t, tc.expected, decodeVaultRequestPayload(t, vaultRequestBodies[len(vaultRequestBodies)-1]))
+		})
+	}
+
+	t.Run("wrapped secret ID is only unwrapped once", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		secretFunc = generateSecretFunc(t, []*api.Secret{
+			{Data: map[string]interface{}{"secret_id": "unwrapped-secret-id"}},
+			with1hLease,
+			with1hLease,
+		})
+
+		vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+		require.NoError(t, err)
+		a, err := newAppRoleAuthenticator(hclog.NewNullLogger(), config.AuthConfig{
+			Method:                 config.AuthMethodAppRole,
+			AppRoleRoleID:          "role-id",
+			AppRoleWrappedSecretID: "wrapping-token",
+		})
+		require.NoError(t, err)
+
+		_, err = a.Login(context.Background(), vaultClient)
+		require.NoError(t, err)
+		_, err = a.Login(context.Background(), vaultClient)
+		require.NoError(t, err)
+		require.Len(t, vaultRequests, 3)
+		require.Equal(t, "wrapping-token", vaultRequests[0].Header.Get("X-Vault-Token"))
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+// Authenticator logs in to Vault with one auth method. Client delegates to it
+// whenever it needs a new token, and handles renewing the token itself.
+type Authenticator interface {
+	// Login authenticates using the given client and returns Vault's response,
+	// which holds the new token and its lease. It does not set the client's
+	// token.
+	Login(ctx context.Context, client *api.Client) (*api.Secret, error)
+}
+
+// NewAuthenticator returns the Authenticator for the auth method in
+// authConfig, checking that the method's required settings are given.
+func NewAuthenticator(logger hclog.Logger, authConfig config.AuthConfig, awsCfg aws.Config) (Authenticator, error) {
+	switch authConfig.Method {
+	case "", config.AuthMethodAWS:
+		return newIAMAuthenticator(logger, authConfig, awsCfg)
+	case config.AuthMethodAppRole:
+		return newAppRoleAuthenticator(logger, authConfig)
+	case config.AuthMethodJWT:
+		return newJWTAuthenticator(logger, authConfig)
+	case config.AuthMethodCert:
+		return newCertAuthenticator(logger, authConfig)
+	case config.AuthMethodToken:
+		return newTokenAuthenticator(logger, authConfig)
+	}
+
+	return nil, fmt.Errorf("unsupported auth method %q set in VAULT_AUTH_METHOD", authConfig.Method)
+}
+
+// cloneWithToken returns a copy of client that uses the given token. Clone
+// doesn't copy headers, so the namespace is set on the copy explicitly.
+func cloneWithToken(client *api.Client, token string) (*api.Client, error) {
+	clone, err := client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if ns := client.Namespace(); ns != "" {
+		clone.SetNamespace(ns)
+	}
+	clone.SetToken(token)
+
+	return clone, nil
+}
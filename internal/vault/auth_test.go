@@ -0,0 +1,83 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+// stubAuthenticator returns a fixed login response and counts its logins.
+type stubAuthenticator struct {
+	secret *api.Secret
+	logins int
+}
+
+func (a *stubAuthenticator) Login(_ context.Context, _ *api.Client) (*api.Secret, error) {
+	a.logins++
+	return a.secret, nil
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		authConfig config.AuthConfig
+		err        string
+	}{
+		{"aws", config.AuthConfig{Method: config.AuthMethodAWS, Provider: "aws", Role: "role"}, ""},
+		{"defaults to aws", config.AuthConfig{Provider: "aws", Role: "role"}, ""},
+		{"aws missing role", config.AuthConfig{Method: config.AuthMethodAWS, Provider: "aws"}, "VAULT_AUTH_ROLE"},
+		{"unsupported", config.AuthConfig{Method: "kerberos"}, `unsupported auth method "kerberos"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := NewAuthenticator(hclog.NewNullLogger(), tc.authConfig, aws.Config{})
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, a)
+		})
+	}
+}
+
+func TestToken_DelegatesToAuthenticator(t *testing.T) {
+	vault := fakeVault()
+	defer vault.Close()
+	vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+	require.NoError(t, err)
+
+	authenticator := &stubAuthenticator{secret: with1hLease}
+	c := Client{
+		VaultClient:   vaultClient,
+		logger:        hclog.NewNullLogger(),
+		authenticator: authenticator,
+	}
+
+	vaultRequests = []*http.Request{}
+	token, err := c.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "foo-1h-token", token)
+	require.Equal(t, 1, authenticator.logins)
+	require.Equal(t, time.Hour, c.tokenTTL)
+	require.True(t, c.tokenRenewable)
+
+	// The token is renewed by the client, not the authenticator.
+	c.tokenExpiry = time.Now().Add(time.Minute)
+	secretFunc = generateSecretFunc(t, []*api.Secret{with1hLease})
+	_, err = c.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, authenticator.logins)
+	require.Equal(t, 1, len(vaultRequests))
+	require.Equal(t, "/v1/auth/token/renew-self", vaultRequests[0].URL.Path)
+}
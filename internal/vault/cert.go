@@ -0,0 +1,51 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+// certAuthenticator logs in with the TLS certificate auth method. Vault
+// authenticates the client certificate presented in the TLS handshake, which
+// NewClient configures on the client's HTTP transport.
+type certAuthenticator struct {
+	logger     hclog.Logger
+	authConfig config.AuthConfig
+}
+
+func newCertAuthenticator(logger hclog.Logger, authConfig config.AuthConfig) (*certAuthenticator, error) {
+	if authConfig.ClientCert == "" || authConfig.ClientKey == "" {
+		return nil, errors.New("missing VLE_VAULT_CLIENT_CERT and VLE_VAULT_CLIENT_KEY, or VAULT_CLIENT_CERT and VAULT_CLIENT_KEY environment variables")
+	}
+
+	return &certAuthenticator{
+		logger:     logger,
+		authConfig: authConfig,
+	}, nil
+}
+
+// Login logs in with the client certificate, optionally against the
+// certificate role named in VAULT_AUTH_ROLE.
+func (a *certAuthenticator) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	var data map[string]interface{}
+	if a.authConfig.Role != "" {
+		data = map[string]interface{}{"name": a.authConfig.Role}
+	}
+
+	mount := a.authConfig.Mount()
+	secret, err := client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", mount), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with Vault TLS certificate auth method at %q: %w", mount, err)
+	}
+
+	return secret, nil
+}
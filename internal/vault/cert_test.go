@@ -0,0 +1,118 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+func TestCertAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCert(t, dir, "lambda-client")
+
+	var mtx sync.Mutex
+	peers := make(map[string]string)
+	var loginBody map[string]interface{}
+	vault := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(r.TLS.PeerCertificates) > 0 {
+			peers[r.URL.Path] = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		if r.URL.Path == "/v1/auth/cert/login" {
+			_ = json.NewDecoder(r.Body).Decode(&loginBody)
+			_ = json.NewEncoder(w).Encode(with1hLease)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&api.Secret{Data: map[string]interface{}{"foo": "bar"}})
+	}))
+	vault.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	vault.StartTLS()
+	defer vault.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: vault.Certificate().Raw}), 0600))
+	vaultConfig := api.DefaultConfig()
+	require.NoError(t, vaultConfig.Error)
+	vaultConfig.Address = vault.URL
+	require.NoError(t, vaultConfig.ConfigureTLS(&api.TLSConfig{CACert: caFile}))
+
+	client, err := NewClient("", "", hclog.NewNullLogger(), vaultConfig, config.AuthConfig{
+		Method:     config.AuthMethodCert,
+		Role:       "lambda",
+		ClientCert: certFile,
+		ClientKey:  keyFile,
+	}, aws.Config{})
+	require.NoError(t, err)
+
+	token, err := client.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "foo-1h-token", token)
+	require.Equal(t, map[string]interface{}{"name": "lambda"}, loginBody)
+
+	// The proxy forwards requests with the config's HTTP client, which must
+	// present the same certificate.
+	resp, err := client.VaultConfig.HttpClient.Get(vault.URL + "/v1/secret/foo")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	require.Equal(t, map[string]string{
+		"/v1/auth/cert/login": "lambda-client",
+		"/v1/secret/foo":      "lambda-client",
+	}, peers)
+
+	t.Run("requires a client certificate", func(t *testing.T) {
+		_, err := NewAuthenticator(hclog.NewNullLogger(), config.AuthConfig{Method: config.AuthMethodCert}, aws.Config{})
+		require.ErrorContains(t, err, "VAULT_CLIENT_CERT")
+	})
+}
+
+// writeClientCert writes a self-signed client certificate and its key to dir.
+func writeClientCert(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile
+}
@@ -5,20 +5,14 @@ package vault
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/api"
 
@@ -28,7 +22,6 @@ import (
 const (
 	tokenExpiryGracePeriodEnv     = "VAULT_TOKEN_EXPIRY_GRACE_PERIOD"
 	defaultTokenExpiryGracePeriod = 10 * time.Second
-	defaultSTSRegion              = "us-east-1"
 )
 
 // Client holds api.Client and handles state required to renew tokens and re-auth as required.
@@ -41,9 +34,12 @@ type Client struct {
 	VaultClient *api.Client
 	VaultConfig *api.Config
 
-	logger     hclog.Logger
-	awsCfg     aws.Config
-	authConfig config.AuthConfig
+	logger        hclog.Logger
+	authConfig    config.AuthConfig
+	authenticator Authenticator
+
+	// authNamespace is the namespace used to log in and renew the token.
+	authNamespace string
 
 	// Token refresh/renew data.
 	tokenExpiryGracePeriod time.Duration
@@ -51,32 +47,74 @@ type Client struct {
 	tokenTTL               time.Duration
 	tokenRenewable         bool
 	tokenRevoked           bool
+	tokenNonExpiring       bool
+
+	retryTimeout time.Duration
+
+	// refreshing is true while a background refresh started by RefreshToken
+	// is in progress.
+	refreshing atomic.Bool
 }
 
-// NewClient uses the AWS IAM auth method configured in a Vault cluster to
-// authenticate the execution role and create a Vault API client.
+// NewClient creates a Vault API client that authenticates with the auth method
+// given in authConfig. The AWS config is only used by the AWS IAM auth method.
+// If a client certificate is configured, it is added to vaultConfig's TLS
+// config. VaultClient uses the secrets namespace, if one is configured, and
+// the auth namespace is only used to log in and renew the token. Both default
+// to the namespace from VAULT_NAMESPACE.
 func NewClient(name, version string, logger hclog.Logger, vaultConfig *api.Config, authConfig config.AuthConfig, awsCfg aws.Config) (*Client, error) {
+	// The client certificate is set on the config's HTTP client, so it is
+	// presented on every request, including those forwarded by the proxy.
+	if authConfig.ClientCert != "" || authConfig.ClientKey != "" {
+		if err := vaultConfig.ConfigureTLS(&api.TLSConfig{
+			ClientCert: authConfig.ClientCert,
+			ClientKey:  authConfig.ClientKey,
+		}); err != nil {
+			return nil, fmt.Errorf("error configuring client certificate: %w", err)
+		}
+	}
+
 	vaultClient, err := api.NewClient(vaultConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error making extension: %w", err)
 	}
+	authNamespace := authConfig.Namespace
+	if authNamespace == "" {
+		authNamespace = vaultClient.Namespace()
+	}
+	if authConfig.SecretsNamespace != "" {
+		vaultClient.SetNamespace(authConfig.SecretsNamespace)
+	}
 
 	expiryGracePeriod, err := parseTokenExpiryGracePeriod()
 	if err != nil {
 		return nil, err
 	}
 
+	retryTimeout, err := parseRetryTimeout()
+	if err != nil {
+		return nil, err
+	}
+	vaultClient.SetCheckRetry(skipRetriesForCaller(vaultClient.CheckRetry()))
+
+	authenticator, err := NewAuthenticator(logger, authConfig, awsCfg)
+	if err != nil {
+		return nil, err
+	}
+
 	client := &Client{
 		VaultClient: vaultClient,
 		VaultConfig: vaultConfig,
 		Name:        name,
 		Version:     version,
 
-		logger:     logger,
-		awsCfg:     awsCfg,
-		authConfig: authConfig,
+		logger:        logger,
+		authConfig:    authConfig,
+		authenticator: authenticator,
+		authNamespace: authNamespace,
 
 		tokenExpiryGracePeriod: expiryGracePeriod,
+		retryTimeout:           retryTimeout,
 	}
 
 	return client, nil
@@ -91,14 +129,14 @@ func (c *Client) Token(ctx context.Context) (string, error) {
 
 	if c.expired() || c.tokenRevoked {
 		c.logger.Debug("authenticating to Vault")
-		err := c.login(ctx)
+		err := c.retry(ctx, "login", c.login)
 		if err != nil {
 			return "", err
 		}
 	} else if c.shouldRenew() {
-		// Renew but don't retry or bail on errors, just best effort.
+		// Renew but don't bail on errors, just best effort.
 		c.logger.Debug("renewing Vault token")
-		err := c.renew()
+		err := c.retry(ctx, "token renewal", c.renew)
 		if err != nil {
 			c.logger.Error("failed to renew token but attempting to continue", "error", err)
 		}
@@ -108,66 +146,64 @@ func (c *Client) Token(ctx context.Context) (string, error) {
 	return c.VaultClient.Token(), nil
 }
 
-// Mark token revoked
-func (c *Client) RevokeToken() {
-	c.tokenRevoked = true
-}
-
-// login authenticates to Vault using IAM auth, and sets the client's token.
-func (c *Client) login(ctx context.Context) error {
-	authConfig := c.authConfig
-	roleToAssumeArn := authConfig.AssumedRoleArn
-
-	stsSvc := sts.NewFromConfig(c.awsCfg)
+// RefreshToken starts renewing or re-authenticating in the background if the
+// next call to Token would otherwise have to, and returns without waiting.
+// Only one background refresh runs at a time. Errors are logged, and Token
+// tries again synchronously on the next request.
+func (c *Client) RefreshToken(ctx context.Context) {
+	if !c.refreshing.CompareAndSwap(false, true) {
+		return
+	}
 
-	/* If passing in a role (through VAULT_ASSUMED_ROLE_ARN enviornment variable)
-	to be assumed for Vault authentication, use it instead of the function execution role */
-	if roleToAssumeArn != "" {
-		c.logger.Debug(fmt.Sprintf("Trying to assume role with arn of %s to authenticate with Vault", roleToAssumeArn))
-		sessionName := "vault_auth"
+	go func() {
+		defer c.refreshing.Store(false)
 
-		assumeRoleOutput, err := stsSvc.AssumeRole(ctx, &sts.AssumeRoleInput{
-			RoleArn:         aws.String(roleToAssumeArn),
-			RoleSessionName: aws.String(sessionName),
-		})
-		if err != nil {
-			return fmt.Errorf("failed to assume role with arn of %s: %w", roleToAssumeArn, err)
+		c.mtx.Lock()
+		due := c.expired() || c.tokenRevoked || c.shouldRenew()
+		c.mtx.Unlock()
+		if !due {
+			return
 		}
-		if assumeRoleOutput.Credentials == nil {
-			return fmt.Errorf("failed to assume role with arn of %s: no credentials returned", roleToAssumeArn)
-		}
-
-		c.logger.Debug(fmt.Sprintf("Assumed role successfully with token expiration time: %s ", aws.ToTime(assumeRoleOutput.Credentials.Expiration).String()))
 
-		assumedRoleCfg := c.awsCfg.Copy()
-		if authConfig.STSEndpointRegion != "" {
-			assumedRoleCfg.Region = authConfig.STSEndpointRegion
+		c.logger.Debug("refreshing Vault token in the background")
+		if _, err := c.Token(ctx); err != nil {
+			c.logger.Warn("failed to refresh token in the background, will retry on next request", "error", err)
 		}
-		assumedRoleCfg.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
-			aws.ToString(assumeRoleOutput.Credentials.AccessKeyId),
-			aws.ToString(assumeRoleOutput.Credentials.SecretAccessKey),
-			aws.ToString(assumeRoleOutput.Credentials.SessionToken),
-		))
+	}()
+}
 
-		stsSvc = sts.NewFromConfig(assumedRoleCfg)
-	}
+// RevokeSelf revokes the client's token with auth/token/revoke-self, if it has
+// one. If the client is used again, it logs in for a new token.
+func (c *Client) RevokeSelf(ctx context.Context) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
 
-	stsOptions := stsSvc.Options()
-	if stsOptions.Credentials == nil {
-		return fmt.Errorf("failed to authenticate with Vault IAM auth provider %q: missing STS credentials provider", authConfig.Provider)
+	if c.VaultClient.Token() == "" || c.tokenRevoked {
+		return nil
 	}
-
-	d, err := buildIAMAuthPayload(ctx, stsSvc, authConfig)
-	if err != nil {
-		return fmt.Errorf("failed to build the IAM auth payload for provider %q, please try again: %w", authConfig.Provider, err)
+	if err := c.authClient().Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+		return err
 	}
+	c.VaultClient.ClearToken()
+	c.tokenRevoked = true
 
-	secret, err := c.VaultClient.Logical().Write(fmt.Sprintf("auth/%s/login", authConfig.Provider), d)
+	return nil
+}
+
+// Mark token revoked
+func (c *Client) RevokeToken() {
+	c.tokenRevoked = true
+}
+
+// login authenticates to Vault with the configured auth method, and sets the
+// client's token.
+func (c *Client) login(ctx context.Context) error {
+	secret, err := c.authenticator.Login(ctx, c.authClient())
 	if err != nil {
-		return fmt.Errorf("failed to authenticate with Vault IAM auth provider %q: %w", authConfig.Provider, err)
+		return err
 	}
 	if secret == nil {
-		return fmt.Errorf("got no response from the %s authentication provider", authConfig.Provider)
+		return fmt.Errorf("got no response from the %s auth method", c.authConfig.Method)
 	}
 
 	token, err := secret.TokenID()
@@ -179,94 +215,29 @@ func (c *Client) login(ctx context.Context) error {
 	return c.updateTokenMetadata(secret)
 }
 
-// buildIAMAuthPayload builds and signs a GetCallerIdentity request, then packages
-// it into the payload expected by Vault's AWS IAM auth login endpoint.
-func buildIAMAuthPayload(ctx context.Context, stsSvc *sts.Client, authConfig config.AuthConfig) (map[string]interface{}, error) {
-	stsOptions := stsSvc.Options()
-	stsRegion := stsOptions.Region
-	if stsRegion == "" {
-		stsRegion = defaultSTSRegion
-	}
-
-	stsEndpoint, err := resolveSTSEndpointURL(ctx, stsOptions)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve STS endpoint URL: %w", err)
-	}
-
-	body := "Action=GetCallerIdentity&Version=2011-06-15"
-	bodyHash := fmt.Sprintf("%x", sha256.Sum256([]byte(body)))
-
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, stsEndpoint, strings.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to build STS GetCallerIdentity request: %w", err)
-	}
-	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	if authConfig.IAMServerID != "" {
-		httpReq.Header.Set("X-Vault-AWS-IAM-Server-ID", authConfig.IAMServerID)
-	}
-
-	creds, err := stsOptions.Credentials.Retrieve(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve AWS credentials for STS request signing: %w", err)
-	}
-	if err := v4.NewSigner().SignHTTP(ctx, creds, httpReq, bodyHash, "sts", stsRegion, time.Now()); err != nil {
-		return nil, fmt.Errorf("failed to sign STS GetCallerIdentity request: %w", err)
-	}
-
-	headers, err := json.Marshal(httpReq.Header)
+func (c *Client) renew(ctx context.Context) error {
+	secret, err := c.authClient().Auth().Token().RenewSelfWithContext(ctx, int(c.tokenTTL.Seconds()))
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal signed STS request headers: %w", err)
+		return err
 	}
 
-	return map[string]interface{}{
-		"iam_http_request_method": http.MethodPost,
-		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(stsEndpoint)),
-		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
-		"iam_request_body":        base64.StdEncoding.EncodeToString([]byte(body)),
-		"role":                    authConfig.Role,
-	}, nil
+	return c.updateTokenMetadata(secret)
 }
 
-// resolveSTSEndpointURL resolves the concrete STS endpoint using the SDK's
-// endpoint resolver, then normalizes it to a URL safe for signing.
-func resolveSTSEndpointURL(ctx context.Context, opts sts.Options) (string, error) {
-	resolver := opts.EndpointResolverV2
-	if resolver == nil {
-		resolver = sts.NewDefaultEndpointResolverV2()
-	}
-
-	region := opts.Region
-	if region == "" {
-		region = defaultSTSRegion
-	}
-
-	endpoint, err := resolver.ResolveEndpoint(ctx, sts.EndpointParameters{
-		Region:       aws.String(region),
-		UseDualStack: aws.Bool(opts.EndpointOptions.UseDualStackEndpoint == aws.DualStackEndpointStateEnabled),
-		UseFIPS:      aws.Bool(opts.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
-		Endpoint:     opts.BaseEndpoint,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to resolve STS endpoint for region %q: %w", region, err)
-	}
-
-	u := endpoint.URI
-	u.RawQuery = ""
-	u.Fragment = ""
-	if u.Path == "" {
-		u.Path = "/"
+// authClient returns the client to use for requests to the auth method and
+// token endpoints, scoped to the auth namespace.
+func (c *Client) authClient() *api.Client {
+	if c.VaultClient == nil || c.authNamespace == c.VaultClient.Namespace() {
+		return c.VaultClient
 	}
 
-	return u.String(), nil
+	return c.VaultClient.WithNamespace(c.authNamespace)
 }
 
-func (c *Client) renew() error {
-	secret, err := c.VaultClient.Auth().Token().RenewSelf(int(c.tokenTTL.Seconds()))
-	if err != nil {
-		return err
-	}
-
-	return c.updateTokenMetadata(secret)
+// SecretsNamespace returns the namespace set with VAULT_SECRETS_NAMESPACE, or
+// an empty string if it was not set.
+func (c *Client) SecretsNamespace() string {
+	return c.authConfig.SecretsNamespace
 }
 
 // Stores metadata about token lease that informs when to re-auth or renew.
@@ -278,6 +249,8 @@ func (c *Client) updateTokenMetadata(secret *api.Secret) error {
 	}
 
 	c.tokenRevoked = false
+	// A TTL of 0 means the token never expires, such as a root token.
+	c.tokenNonExpiring = c.tokenTTL == 0
 	c.tokenExpiry = time.Now().Round(0).Add(c.tokenTTL)
 	c.tokenRenewable, err = secret.TokenIsRenewable()
 	if err != nil {
@@ -289,11 +262,19 @@ func (c *Client) updateTokenMetadata(secret *api.Secret) error {
 
 // Returns true if current time is after tokenExpiry, or within 10s.
 func (c *Client) expired() bool {
+	if c.tokenNonExpiring {
+		return false
+	}
+
 	return time.Now().Round(0).Add(c.tokenExpiryGracePeriod).After(c.tokenExpiry)
 }
 
 // Returns true if tokenExpiry time is in less than 20% of tokenTTL.
 func (c *Client) shouldRenew() bool {
+	if c.tokenNonExpiring {
+		return false
+	}
+
 	remaining := time.Until(c.tokenExpiry)
 	return c.tokenRenewable && remaining.Nanoseconds() < c.tokenTTL.Nanoseconds()/5
 }
@@ -15,6 +15,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -179,9 +180,12 @@ func TestTokenRenewal(t *testing.T) {
 		c := Client{
 			VaultClient: generateVaultClient(),
 			logger:      hclog.Default(),
-			awsCfg:      awsCfg,
-			authConfig: config.AuthConfig{
-				Provider: "aws",
+			authenticator: &iamAuthenticator{
+				logger: hclog.Default(),
+				awsCfg: awsCfg,
+				authConfig: config.AuthConfig{
+					Provider: "aws",
+				},
 			},
 		}
 		secretFunc = generateSecretFunc(t, []*api.Secret{
@@ -202,9 +206,12 @@ func TestTokenRenewal(t *testing.T) {
 		c := Client{
 			VaultClient: generateVaultClient(),
 			logger:      hclog.Default(),
-			awsCfg:      awsCfg,
-			authConfig: config.AuthConfig{
-				Provider: "aws",
+			authenticator: &iamAuthenticator{
+				logger: hclog.Default(),
+				awsCfg: awsCfg,
+				authConfig: config.AuthConfig{
+					Provider: "aws",
+				},
 			},
 			tokenExpiry: time.Now().Add(time.Hour),
 		}
@@ -228,9 +235,12 @@ func TestTokenRenewal(t *testing.T) {
 		c := Client{
 			VaultClient: generateVaultClient(),
 			logger:      hclog.Default(),
-			awsCfg:      awsCfg,
-			authConfig: config.AuthConfig{
-				Provider: "aws",
+			authenticator: &iamAuthenticator{
+				logger: hclog.Default(),
+				awsCfg: awsCfg,
+				authConfig: config.AuthConfig{
+					Provider: "aws",
+				},
 			},
 		}
 		secretFunc = func() (*api.Secret, error) {
@@ -320,6 +330,133 @@ func TestTokenRenewal(t *testing.T) {
 	})
 }
 
+func TestRefreshToken(t *testing.T) {
+	// The fake Vault blocks each lookup until release is closed, so the test
+	// can check that only one refresh is in flight.
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		_ = json.NewEncoder(w).Encode(lookupSelfResponse("token", 3600, true))
+	}))
+	defer srv.Close()
+
+	vaultClient, err := api.NewClient(&api.Config{Address: srv.URL})
+	require.NoError(t, err)
+	authConfig := config.AuthConfig{Method: config.AuthMethodToken, Token: "token"}
+	a, err := newTokenAuthenticator(hclog.NewNullLogger(), authConfig)
+	require.NoError(t, err)
+	c := &Client{
+		VaultClient:   vaultClient,
+		logger:        hclog.NewNullLogger(),
+		authConfig:    authConfig,
+		authenticator: a,
+	}
+
+	// The token has never been fetched, so it is expired.
+	c.RefreshToken(context.Background())
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&requests) == 1
+	}, time.Second, 10*time.Millisecond)
+	c.RefreshToken(context.Background())
+	c.RefreshToken(context.Background())
+	close(release)
+	require.Eventually(t, func() bool {
+		return !c.refreshing.Load()
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// The synchronous path uses the refreshed token without another request.
+	token, err := c.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token", token)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// No refresh is started while the token is valid.
+	c.RefreshToken(context.Background())
+	require.Eventually(t, func() bool {
+		return !c.refreshing.Load()
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// A token due for renewal is renewed.
+	c.mtx.Lock()
+	c.tokenExpiry = time.Now().Add(time.Minute)
+	c.mtx.Unlock()
+	c.RefreshToken(context.Background())
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&requests) == 2 && !c.refreshing.Load()
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRevokeSelf(t *testing.T) {
+	vault := fakeVault()
+	defer vault.Close()
+
+	t.Run("revokes the token once", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		secretFunc = generateSecretFunc(t, []*api.Secret{nil})
+		vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+		require.NoError(t, err)
+		vaultClient.SetToken(t.Name())
+		c := Client{VaultClient: vaultClient, logger: hclog.NewNullLogger()}
+
+		require.NoError(t, c.RevokeSelf(context.Background()))
+		require.NoError(t, c.RevokeSelf(context.Background()))
+		require.Len(t, vaultRequests, 1)
+		require.Equal(t, "/v1/auth/token/revoke-self", vaultRequests[0].URL.Path)
+		require.Equal(t, t.Name(), vaultRequests[0].Header.Get("X-Vault-Token"))
+		require.Empty(t, c.VaultClient.Token())
+		require.True(t, c.tokenRevoked)
+	})
+
+	t.Run("no token to revoke", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+		require.NoError(t, err)
+		vaultClient.ClearToken()
+		c := Client{VaultClient: vaultClient, logger: hclog.NewNullLogger()}
+
+		require.NoError(t, c.RevokeSelf(context.Background()))
+		require.Empty(t, vaultRequests)
+	})
+
+	t.Run("error is returned and token kept", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		secretFunc = func() (*api.Secret, error) {
+			return nil, errors.New("permission denied")
+		}
+		vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+		require.NoError(t, err)
+		vaultClient.SetToken(t.Name())
+		c := Client{VaultClient: vaultClient, logger: hclog.NewNullLogger()}
+
+		require.Error(t, c.RevokeSelf(context.Background()))
+		require.Equal(t, t.Name(), c.VaultClient.Token())
+		require.False(t, c.tokenRevoked)
+	})
+
+	t.Run("bounded by the context", func(t *testing.T) {
+		blocked := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-blocked
+		}))
+		defer srv.Close()
+		defer close(blocked)
+		vaultClient, err := api.NewClient(&api.Config{Address: srv.URL})
+		require.NoError(t, err)
+		vaultClient.SetToken(t.Name())
+		c := Client{VaultClient: vaultClient, logger: hclog.NewNullLogger()}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		require.Error(t, c.RevokeSelf(ctx))
+		require.Less(t, time.Since(start), time.Second)
+	})
+}
+
 func TestParseTokenExpiryGracePeriod(t *testing.T) {
 	for _, tc := range []struct {
 		duration string
@@ -381,6 +518,89 @@ func TestUserAgentHeaderAddition(t *testing.T) {
 	})
 }
 
+func TestNamespaces(t *testing.T) {
+	vault := fakeVault()
+	defer vault.Close()
+
+	for name, tc := range map[string]struct {
+		envNamespace     string
+		authNamespace    string
+		secretsNamespace string
+		expectedAuth     string
+		expectedSecrets  string
+	}{
+		"none": {},
+		"VAULT_NAMESPACE used for everything": {
+			envNamespace:    "ns1",
+			expectedAuth:    "ns1",
+			expectedSecrets: "ns1",
+		},
+		"auth namespace only used for token": {
+			envNamespace:    "ns1/child",
+			authNamespace:   "ns1",
+			expectedAuth:    "ns1",
+			expectedSecrets: "ns1/child",
+		},
+		"secrets namespace overrides VAULT_NAMESPACE": {
+			envNamespace:     "ns1",
+			authNamespace:    "admin",
+			secretsNamespace: "admin/team",
+			expectedAuth:     "admin",
+			expectedSecrets:  "admin/team",
+		},
+		"auth namespace defaults to VAULT_NAMESPACE": {
+			envNamespace:     "admin",
+			secretsNamespace: "admin/team",
+			expectedAuth:     "admin",
+			expectedSecrets:  "admin/team",
+		},
+		"secrets namespace only": {
+			secretsNamespace: "admin/team",
+			expectedAuth:     "",
+			expectedSecrets:  "admin/team",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("VAULT_NAMESPACE", tc.envNamespace)
+			t.Setenv(tokenExpiryGracePeriodEnv, "")
+			vaultRequests = []*http.Request{}
+			secretFunc = generateSecretFunc(t, []*api.Secret{
+				lookupSelfResponse("token", 3600, true),
+				with1hLease,
+				{Data: map[string]interface{}{"foo": "bar"}},
+			})
+			vaultConfig := api.DefaultConfig()
+			vaultConfig.Address = vault.URL
+			c, err := NewClient("", "", hclog.NewNullLogger(), vaultConfig, config.AuthConfig{
+				Method:           config.AuthMethodToken,
+				Token:            "token",
+				Namespace:        tc.authNamespace,
+				SecretsNamespace: tc.secretsNamespace,
+			}, aws.Config{})
+			require.NoError(t, err)
+
+			// Log in, then force a renewal.
+			_, err = c.Token(context.Background())
+			require.NoError(t, err)
+			c.tokenExpiry = time.Now().Add(time.Minute)
+			_, err = c.Token(context.Background())
+			require.NoError(t, err)
+			_, err = c.VaultClient.Logical().Read("secret/foo")
+			require.NoError(t, err)
+
+			require.Len(t, vaultRequests, 3)
+			require.Equal(t, "/v1/auth/token/lookup-self", vaultRequests[0].URL.Path)
+			require.Equal(t, tc.expectedAuth, vaultRequests[0].Header.Get("X-Vault-Namespace"))
+			require.Equal(t, "/v1/auth/token/renew-self", vaultRequests[1].URL.Path)
+			require.Equal(t, tc.expectedAuth, vaultRequests[1].Header.Get("X-Vault-Namespace"))
+			require.Equal(t, "/v1/secret/foo", vaultRequests[2].URL.Path)
+			require.Equal(t, tc.expectedSecrets, vaultRequests[2].Header.Get("X-Vault-Namespace"))
+			require.Equal(t, tc.expectedSecrets, c.VaultClient.Namespace())
+			require.Equal(t, tc.secretsNamespace, c.SecretsNamespace())
+		})
+	}
+}
+
 func TestBuildIAMAuthPayload_SignedHeaders(t *testing.T) {
 	stsSvc := sts.NewFromConfig(aws.Config{
 		Region:       "us-east-1",
@@ -432,9 +652,12 @@ func TestResolveSTSEndpointURL_DefaultsRegionToUSEast1(t *testing.T) {
 
 func TestLogin_MissingCredentialsProviderReturnsMeaningfulError(t *testing.T) {
 	c := Client{
-		logger:     hclog.Default(),
-		awsCfg:     aws.Config{},
-		authConfig: config.AuthConfig{Provider: "aws"},
+		logger: hclog.Default(),
+		authenticator: &iamAuthenticator{
+			logger:     hclog.Default(),
+			awsCfg:     aws.Config{},
+			authConfig: config.AuthConfig{Provider: "aws"},
+		},
 	}
 
 	err := c.login(context.Background())
@@ -484,21 +707,23 @@ func TestToken_UsesAssumedRoleArnWithSTSEndpointRegion(t *testing.T) {
 	vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
 	require.NoError(t, err)
 
+	authenticator, err := newIAMAuthenticator(hclog.Default(), config.AuthConfig{
+		Provider:          "aws",
+		Role:              "test-role",
+		AssumedRoleArn:    "arn:aws:iam::123456789012:role/test-role",
+		STSEndpointRegion: "eu-west-1",
+	}, aws.Config{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(stsServer.URL),
+		Credentials: aws.NewCredentialsCache(
+			credentials.NewStaticCredentialsProvider("foo", "foo", "foo"),
+		),
+	})
+	require.NoError(t, err)
 	c := Client{
-		VaultClient: vaultClient,
-		logger:      hclog.Default(),
-		awsCfg: aws.Config{
-			Region:       "us-east-1",
-			BaseEndpoint: aws.String(stsServer.URL),
-			Credentials: aws.NewCredentialsCache(
-				credentials.NewStaticCredentialsProvider("foo", "foo", "foo"),
-			),
-		},
-		authConfig: config.AuthConfig{
-			Provider:          "aws",
-			AssumedRoleArn:    "arn:aws:iam::123456789012:role/test-role",
-			STSEndpointRegion: "eu-west-1",
-		},
+		VaultClient:   vaultClient,
+		logger:        hclog.Default(),
+		authenticator: authenticator,
 	}
 
 	token, err := c.Token(context.Background())
@@ -0,0 +1,293 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+const (
+	defaultSTSRegion   = "us-east-1"
+	defaultSessionName = "vault_auth"
+
+	// functionNamePlaceholder is replaced with the function's name in the
+	// session name and session tag values.
+	functionNamePlaceholder = "{function_name}"
+
+	// maxSessionNameLength is the longest role session name STS accepts.
+	maxSessionNameLength = 64
+)
+
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// iamAuthenticator logs in with the AWS IAM auth method, using the function's
+// execution role or a role assumed from it. Several roles can be assumed in a
+// chain, each using the credentials of the role before it.
+type iamAuthenticator struct {
+	logger     hclog.Logger
+	awsCfg     aws.Config
+	authConfig config.AuthConfig
+
+	roleArns    []string
+	sessionName string
+	sessionTags []types.Tag
+}
+
+func newIAMAuthenticator(logger hclog.Logger, authConfig config.AuthConfig, awsCfg aws.Config) (*iamAuthenticator, error) {
+	if authConfig.Provider == "" || authConfig.Role == "" {
+		return nil, errors.New("missing VAULT_AUTH_PROVIDER or VAULT_AUTH_ROLE environment variables")
+	}
+
+	var roleArns []string
+	for _, arn := range strings.Split(authConfig.AssumedRoleArn, ",") {
+		if arn = strings.TrimSpace(arn); arn != "" {
+			roleArns = append(roleArns, arn)
+		}
+	}
+	sessionTags, err := parseSessionTags(authConfig.SessionTags, authConfig.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	if len(roleArns) == 0 && (authConfig.ExternalID != "" || len(sessionTags) > 0) {
+		return nil, errors.New("VAULT_ASSUMED_ROLE_EXTERNAL_ID and VAULT_ASSUMED_ROLE_SESSION_TAGS require VAULT_ASSUMED_ROLE_ARN")
+	}
+
+	return &iamAuthenticator{
+		logger:      logger,
+		awsCfg:      awsCfg,
+		authConfig:  authConfig,
+		roleArns:    roleArns,
+		sessionName: sessionName(authConfig.SessionName, authConfig.FunctionName),
+		sessionTags: sessionTags,
+	}, nil
+}
+
+// Login signs an STS GetCallerIdentity request and sends it to Vault's AWS
+// auth method.
+func (a *iamAuthenticator) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	authConfig := a.authConfig
+
+	stsSvc, err := a.assumeRoles(ctx, sts.NewFromConfig(a.awsCfg))
+	if err != nil {
+		return nil, err
+	}
+
+	stsOptions := stsSvc.Options()
+	if stsOptions.Credentials == nil {
+		return nil, fmt.Errorf("failed to authenticate with Vault IAM auth provider %q: missing STS credentials provider", authConfig.Provider)
+	}
+
+	d, err := buildIAMAuthPayload(ctx, stsSvc, authConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the IAM auth payload for provider %q, please try again: %w", authConfig.Provider, err)
+	}
+
+	secret, err := client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", authConfig.Provider), d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with Vault IAM auth provider %q: %w", authConfig.Provider, err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("got no response from the %s authentication provider", authConfig.Provider)
+	}
+
+	return secret, nil
+}
+
+// assumeRoles assumes each configured role in turn (through the
+// VAULT_ASSUMED_ROLE_ARN environment variable), and returns an STS client
+// using the credentials of the last one. With no roles configured, it returns
+// stsSvc, which uses the function's execution role.
+//
+// The external ID is sent when assuming the last role, which is the one in
+// another account when chaining. Session tags are set on the first role, and
+// marked transitive when chaining so they carry through to the last one.
+func (a *iamAuthenticator) assumeRoles(ctx context.Context, stsSvc *sts.Client) (*sts.Client, error) {
+	for i, roleArn := range a.roleArns {
+		a.logger.Debug(fmt.Sprintf("Trying to assume role with arn of %s to authenticate with Vault", roleArn))
+		input := &sts.AssumeRoleInput{
+			RoleArn:         aws.String(roleArn),
+			RoleSessionName: aws.String(a.sessionName),
+		}
+		if i == len(a.roleArns)-1 && a.authConfig.ExternalID != "" {
+			input.ExternalId = aws.String(a.authConfig.ExternalID)
+		}
+		if i == 0 && len(a.sessionTags) > 0 {
+			input.Tags = a.sessionTags
+			if len(a.roleArns) > 1 {
+				for _, tag := range a.sessionTags {
+					input.TransitiveTagKeys = append(input.TransitiveTagKeys, aws.ToString(tag.Key))
+				}
+			}
+		}
+
+		assumeRoleOutput, err := stsSvc.AssumeRole(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to assume role with arn of %s: %w", roleArn, err)
+		}
+		if assumeRoleOutput.Credentials == nil {
+			return nil, fmt.Errorf("failed to assume role with arn of %s: no credentials returned", roleArn)
+		}
+
+		a.logger.Debug(fmt.Sprintf("Assumed role successfully with token expiration time: %s ", aws.ToTime(assumeRoleOutput.Credentials.Expiration).String()))
+
+		assumedRoleCfg := a.awsCfg.Copy()
+		if a.authConfig.STSEndpointRegion != "" {
+			assumedRoleCfg.Region = a.authConfig.STSEndpointRegion
+		}
+		assumedRoleCfg.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+			aws.ToString(assumeRoleOutput.Credentials.AccessKeyId),
+			aws.ToString(assumeRoleOutput.Credentials.SecretAccessKey),
+			aws.ToString(assumeRoleOutput.Credentials.SessionToken),
+		))
+
+		stsSvc = sts.NewFromConfig(assumedRoleCfg)
+	}
+
+	return stsSvc, nil
+}
+
+// sessionName returns the role session name, with any function name
+// placeholder expanded and characters STS does not allow replaced.
+func sessionName(configured, functionName string) string {
+	name := configured
+	if name == "" {
+		name = defaultSessionName
+	}
+	name = strings.ReplaceAll(name, functionNamePlaceholder, functionName)
+	name = invalidSessionNameChars.ReplaceAllString(name, "-")
+	if len(name) > maxSessionNameLength {
+		name = name[:maxSessionNameLength]
+	}
+
+	return name
+}
+
+// parseSessionTags parses session tags given as comma-separated key=value
+// pairs, expanding any function name placeholder in the values.
+func parseSessionTags(configured, functionName string) ([]types.Tag, error) {
+	var tags []types.Tag
+	seen := make(map[string]struct{})
+	for _, pair := range strings.Split(configured, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid session tag %q in VAULT_ASSUMED_ROLE_SESSION_TAGS: must be of the form key=value", pair)
+		}
+		// STS treats tag keys case-insensitively.
+		if _, ok := seen[strings.ToLower(key)]; ok {
+			return nil, fmt.Errorf("session tag %q is set more than once in VAULT_ASSUMED_ROLE_SESSION_TAGS", key)
+		}
+		seen[strings.ToLower(key)] = struct{}{}
+		tags = append(tags, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(strings.ReplaceAll(value, functionNamePlaceholder, functionName)),
+		})
+	}
+
+	return tags, nil
+}
+
+// buildIAMAuthPayload builds and signs a GetCallerIdentity request, then packages
+// it into the payload expected by Vault's AWS IAM auth login endpoint.
+func buildIAMAuthPayload(ctx context.Context, stsSvc *sts.Client, authConfig config.AuthConfig) (map[string]interface{}, error) {
+	stsOptions := stsSvc.Options()
+	stsRegion := stsOptions.Region
+	if stsRegion == "" {
+		stsRegion = defaultSTSRegion
+	}
+
+	stsEndpoint, err := resolveSTSEndpointURL(ctx, stsOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve STS endpoint URL: %w", err)
+	}
+
+	body := "Action=GetCallerIdentity&Version=2011-06-15"
+	bodyHash := fmt.Sprintf("%x", sha256.Sum256([]byte(body)))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, stsEndpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build STS GetCallerIdentity request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if authConfig.IAMServerID != "" {
+		httpReq.Header.Set("X-Vault-AWS-IAM-Server-ID", authConfig.IAMServerID)
+	}
+
+	creds, err := stsOptions.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve AWS credentials for STS request signing: %w", err)
+	}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, httpReq, bodyHash, "sts", stsRegion, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign STS GetCallerIdentity request: %w", err)
+	}
+
+	headers, err := json.Marshal(httpReq.Header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signed STS request headers: %w", err)
+	}
+
+	return map[string]interface{}{
+		"iam_http_request_method": http.MethodPost,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(stsEndpoint)),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+		"iam_request_body":        base64.StdEncoding.EncodeToString([]byte(body)),
+		"role":                    authConfig.Role,
+	}, nil
+}
+
+// resolveSTSEndpointURL resolves the concrete STS endpoint using the SDK's
+// endpoint resolver, then normalizes it to a URL safe for signing.
+func resolveSTSEndpointURL(ctx context.Context, opts sts.Options) (string, error) {
+	resolver := opts.EndpointResolverV2
+	if resolver == nil {
+		resolver = sts.NewDefaultEndpointResolverV2()
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = defaultSTSRegion
+	}
+
+	endpoint, err := resolver.ResolveEndpoint(ctx, sts.EndpointParameters{
+		Region:       aws.String(region),
+		UseDualStack: aws.Bool(opts.EndpointOptions.UseDualStackEndpoint == aws.DualStackEndpointStateEnabled),
+		UseFIPS:      aws.Bool(opts.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
+		Endpoint:     opts.BaseEndpoint,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve STS endpoint for region %q: %w", region, err)
+	}
+
+	u := endpoint.URI
+	u.RawQuery = ""
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,147 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+	"github.com/hashicorp/vault-lambda-extension/internal/ststest"
+)
+
+func TestIAMAuthenticator_AssumeRoleChain(t *testing.T) {
+	vault := fakeVault()
+	defer vault.Close()
+	stsServer, awsCfg := ststest.NewFakeAssumeRoleSTS(&aws.Config{})
+	defer stsServer.Close()
+
+	vaultRequests = []*http.Request{}
+	vaultRequestBodies = [][]byte{}
+	secretFunc = generateSecretFunc(t, []*api.Secret{with1hLease})
+
+	authenticator, err := newIAMAuthenticator(hclog.NewNullLogger(), config.AuthConfig{
+		Provider:       "aws",
+		Role:           "test-role",
+		AssumedRoleArn: "arn:aws:iam::111111111111:role/hop, arn:aws:iam::222222222222:role/target",
+		ExternalID:     "external-id",
+		SessionName:    "vault_{function_name}",
+		SessionTags:    "function={function_name}, team=payments",
+		FunctionName:   "my-function",
+	}, awsCfg)
+	require.NoError(t, err)
+	vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+	require.NoError(t, err)
+	c := Client{
+		VaultClient:   vaultClient,
+		logger:        hclog.NewNullLogger(),
+		authenticator: authenticator,
+	}
+
+	token, err := c.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "foo-1h-token", token)
+
+	requests := stsServer.Requests()
+	require.Len(t, requests, 2)
+
+	// The first role is assumed with the execution role's credentials, and
+	// sets transitive session tags.
+	first := requests[0]
+	require.Equal(t, "foo", first.AccessKeyID)
+	require.Equal(t, "arn:aws:iam::111111111111:role/hop", first.Params.Get("RoleArn"))
+	require.Equal(t, "vault_my-function", first.Params.Get("RoleSessionName"))
+	require.Empty(t, first.Params.Get("ExternalId"))
+	require.Equal(t, "function", first.Params.Get("Tags.member.1.Key"))
+	require.Equal(t, "my-function", first.Params.Get("Tags.member.1.Value"))
+	require.Equal(t, "team", first.Params.Get("Tags.member.2.Key"))
+	require.Equal(t, "payments", first.Params.Get("Tags.member.2.Value"))
+	require.Equal(t, "function", first.Params.Get("TransitiveTagKeys.member.1"))
+	require.Equal(t, "team", first.Params.Get("TransitiveTagKeys.member.2"))
+
+	// The second role is assumed with the first role's credentials, and sends
+	// the external ID.
+	second := requests[1]
+	require.Equal(t, "ASIA1", second.AccessKeyID)
+	require.Equal(t, "arn:aws:iam::222222222222:role/target", second.Params.Get("RoleArn"))
+	require.Equal(t, "vault_my-function", second.Params.Get("RoleSessionName"))
+	require.Equal(t, "external-id", second.Params.Get("ExternalId"))
+	require.Empty(t, second.Params.Get("Tags.member.1.Key"))
+
+	// Vault receives a request signed with the last role's credentials.
+	headers := decodeIAMRequestHeaders(t, decodeVaultRequestPayload(t, vaultRequestBodies[0]))
+	require.Contains(t, headers.Get("Authorization"), "Credential=ASIA2/")
+}
+
+func TestIAMAuthenticator_SingleRoleTagsAreNotTransitive(t *testing.T) {
+	stsServer, awsCfg := ststest.NewFakeAssumeRoleSTS(&aws.Config{})
+	defer stsServer.Close()
+
+	authenticator, err := newIAMAuthenticator(hclog.NewNullLogger(), config.AuthConfig{
+		Provider:       "aws",
+		Role:           "test-role",
+		AssumedRoleArn: "arn:aws:iam::222222222222:role/target",
+		SessionTags:    "team=payments",
+	}, awsCfg)
+	require.NoError(t, err)
+
+	_, err = authenticator.assumeRoles(context.Background(), sts.NewFromConfig(awsCfg))
+	require.NoError(t, err)
+	requests := stsServer.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, defaultSessionName, requests[0].Params.Get("RoleSessionName"))
+	require.Equal(t, "team", requests[0].Params.Get("Tags.member.1.Key"))
+	require.Empty(t, requests[0].Params.Get("TransitiveTagKeys.member.1"))
+}
+
+func TestNewIAMAuthenticator_Errors(t *testing.T) {
+	for name, authConfig := range map[string]config.AuthConfig{
+		"missing role":              {Provider: "aws"},
+		"external ID without roles": {Provider: "aws", Role: "role", ExternalID: "id"},
+		"tags without roles":        {Provider: "aws", Role: "role", SessionTags: "team=payments"},
+		"invalid tag":               {Provider: "aws", Role: "role", AssumedRoleArn: "arn", SessionTags: "team"},
+		"duplicate tag":             {Provider: "aws", Role: "role", AssumedRoleArn: "arn", SessionTags: "team=a,Team=b"},
+	} {
+		_, err := newIAMAuthenticator(hclog.NewNullLogger(), authConfig, aws.Config{})
+		require.Error(t, err, name)
+	}
+}
+
+func TestSessionName(t *testing.T) {
+	for _, tc := range []struct {
+		configured   string
+		functionName string
+		expected     string
+	}{
+		{"", "my-function", "vault_auth"},
+		{"custom", "my-function", "custom"},
+		{"vault-{function_name}", "my-function", "vault-my-function"},
+		{"vault {function_name}:$LATEST", "fn", "vault-fn--LATEST"},
+		{"{function_name}", strings.Repeat("a", 70), strings.Repeat("a", 64)},
+	} {
+		require.Equal(t, tc.expected, sessionName(tc.configured, tc.functionName), tc.configured)
+	}
+}
+
+func TestParseSessionTags(t *testing.T) {
+	tags, err := parseSessionTags("", "fn")
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	tags, err = parseSessionTags(" app = {function_name} ,env=prod,", "fn")
+	require.NoError(t, err)
+	require.Equal(t, []types.Tag{
+		{Key: aws.String("app"), Value: aws.String("fn")},
+		{Key: aws.String("env"), Value: aws.String("prod")},
+	}, tags)
+}
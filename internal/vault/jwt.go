@@ -0,0 +1,78 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+// jwtAuthenticator logs in with the JWT/OIDC auth method. When the JWT is read
+// from a file, the file is read again on every login so that a rotated token
+// is picked up.
+type jwtAuthenticator struct {
+	logger     hclog.Logger
+	authConfig config.AuthConfig
+}
+
+func newJWTAuthenticator(logger hclog.Logger, authConfig config.AuthConfig) (*jwtAuthenticator, error) {
+	if authConfig.Role == "" {
+		return nil, errors.New("missing VAULT_AUTH_ROLE environment variable")
+	}
+	if (authConfig.JWT == "") == (authConfig.JWTFile == "") {
+		return nil, errors.New("exactly one of VAULT_JWT or VAULT_JWT_FILE must be set")
+	}
+
+	return &jwtAuthenticator{
+		logger:     logger,
+		authConfig: authConfig,
+	}, nil
+}
+
+// Login sends the JWT and role to the JWT auth method.
+func (a *jwtAuthenticator) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	jwt, err := a.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	mount := a.authConfig.Mount()
+	secret, err := client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", mount), map[string]interface{}{
+		"jwt":  jwt,
+		"role": a.authConfig.Role,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with Vault JWT auth method at %q: %w", mount, err)
+	}
+
+	return secret, nil
+}
+
+// jwt returns the JWT from the environment, or reads it from the configured
+// file.
+func (a *jwtAuthenticator) jwt() (string, error) {
+	if a.authConfig.JWT != "" {
+		return a.authConfig.JWT, nil
+	}
+
+	b, err := os.ReadFile(a.authConfig.JWTFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read JWT file: %w", err)
+	}
+	jwt := strings.TrimSpace(string(b))
+	if jwt == "" {
+		return "", fmt.Errorf("JWT file %q is empty", a.authConfig.JWTFile)
+	}
+	a.logger.Debug("read JWT from file", "file", a.authConfig.JWTFile)
+
+	return jwt, nil
+}
@@ -0,0 +1,80 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+func TestNewJWTAuthenticator(t *testing.T) {
+	for name, authConfig := range map[string]config.AuthConfig{
+		"missing role":     {JWT: "jwt"},
+		"missing JWT":      {Role: "role"},
+		"both JWT sources": {Role: "role", JWT: "jwt", JWTFile: "/opt/jwt"},
+	} {
+		_, err := newJWTAuthenticator(hclog.NewNullLogger(), authConfig)
+		require.Error(t, err, name)
+	}
+}
+
+func TestJWTAuthenticator_Login(t *testing.T) {
+	vault := fakeVault()
+	defer vault.Close()
+	vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+	require.NoError(t, err)
+
+	t.Run("JWT from env", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		vaultRequestBodies = [][]byte{}
+		secretFunc = generateSecretFunc(t, []*api.Secret{with1hLease})
+
+		a, err := newJWTAuthenticator(hclog.NewNullLogger(), config.AuthConfig{Method: config.AuthMethodJWT, Role: "lambda", JWT: "env-jwt"})
+		require.NoError(t, err)
+		_, err = a.Login(context.Background(), vaultClient)
+		require.NoError(t, err)
+
+		require.Equal(t, "/v1/auth/jwt/login", vaultRequests[0].URL.Path)
+		require.Equal(t, map[string]interface{}{"jwt": "env-jwt", "role": "lambda"}, decodeVaultRequestPayload(t, vaultRequestBodies[0]))
+	})
+
+	t.Run("JWT file is read on every login", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		vaultRequestBodies = [][]byte{}
+		secretFunc = generateSecretFunc(t, []*api.Secret{with1hLease, with1hLease})
+
+		jwtFile := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(jwtFile, []byte("first-jwt\n"), 0600))
+		a, err := newJWTAuthenticator(hclog.NewNullLogger(), config.AuthConfig{Method: config.AuthMethodJWT, Provider: "oidc", Role: "lambda", JWTFile: jwtFile})
+		require.NoError(t, err)
+
+		_, err = a.Login(context.Background(), vaultClient)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(jwtFile, []byte("rotated-jwt"), 0600))
+		_, err = a.Login(context.Background(), vaultClient)
+		require.NoError(t, err)
+
+		require.Equal(t, "/v1/auth/oidc/login", vaultRequests[0].URL.Path)
+		require.Equal(t, "first-jwt", decodeVaultRequestPayload(t, vaultRequestBodies[0])["jwt"])
+		require.Equal(t, "rotated-jwt", decodeVaultRequestPayload(t, vaultRequestBodies[1])["jwt"])
+	})
+
+	t.Run("missing JWT file", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		a, err := newJWTAuthenticator(hclog.NewNullLogger(), config.AuthConfig{Method: config.AuthMethodJWT, Role: "lambda", JWTFile: filepath.Join(t.TempDir(), "missing")})
+		require.NoError(t, err)
+		_, err = a.Login(context.Background(), vaultClient)
+		require.ErrorContains(t, err, "failed to read JWT file")
+		require.Empty(t, vaultRequests)
+	})
+}
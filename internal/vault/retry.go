@@ -0,0 +1,160 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// The total time spent retrying a failed login or token renewal. Set to 0
+	// to disable retries.
+	retryTimeoutEnv     = "VAULT_AUTH_RETRY_TIMEOUT"
+	defaultRetryTimeout = 3 * time.Second
+
+	retryInitialInterval = 100 * time.Millisecond
+	retryMaxInterval     = time.Second
+)
+
+// retryingCallerKey marks a context whose requests are already retried by
+// Client.retry, so the Vault client should not retry them itself.
+type retryingCallerKey struct{}
+
+// retry calls op until it succeeds, it returns an error that isn't worth
+// retrying, or the retry timeout has elapsed. Retries use exponential backoff
+// with jitter, and no new attempt is started once the timeout would be
+// exceeded. An attempt that is already in flight is left to finish within
+// the caller's context. The context passed to op disables the Vault client's
+// own retries, so they don't add to the time spent.
+func (c *Client) retry(ctx context.Context, description string, op func(ctx context.Context) error) error {
+	if c.retryTimeout <= 0 {
+		return op(ctx)
+	}
+
+	ctx = context.WithValue(ctx, retryingCallerKey{}, true)
+
+	b := backoff.NewExponentialBackOff(
+		backoff.WithInitialInterval(retryInitialInterval),
+		backoff.WithMaxInterval(retryMaxInterval),
+		backoff.WithMaxElapsedTime(c.retryTimeout),
+	)
+
+	return backoff.RetryNotify(func() error {
+		err := op(ctx)
+		if err != nil && !isRetryable(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(b, ctx), func(err error, wait time.Duration) {
+		c.logger.Warn(fmt.Sprintf("%s failed, retrying in %v", description, wait), "error", err)
+	})
+}
+
+// skipRetriesForCaller wraps the Vault client's retry policy so that requests
+// made within Client.retry are not also retried by the Vault client, whose
+// waits of over a second between attempts would otherwise use up the retry
+// timeout.
+func skipRetriesForCaller(checkRetry func(context.Context, *http.Response, error) (bool, error)) func(context.Context, *http.Response, error) (bool, error) {
+	if checkRetry == nil {
+		checkRetry = api.DefaultRetryPolicy
+	}
+
+	return func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if ctx.Value(retryingCallerKey{}) != nil {
+			return false, nil
+		}
+		return checkRetry(ctx, resp, err)
+	}
+}
+
+// isRetryable returns true for errors that are likely to be temporary: 5xx and
+// 429 responses from Vault, transport errors such as refused or reset
+// connections and timeouts, and throttling by AWS STS. TLS and certificate
+// errors won't go away by retrying, so they are not retried.
+func isRetryable(err error) bool {
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode >= http.StatusInternalServerError || respErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	if isTLSError(err) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// An invalid URL fails the same way every time.
+		return urlErr.Op != "parse"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		_, ok := retry.DefaultThrottleErrorCodes[apiErr.ErrorCode()]
+		return ok
+	}
+
+	return false
+}
+
+func isTLSError(err error) bool {
+	var (
+		verificationErr *tls.CertificateVerificationError
+		recordHeaderErr tls.RecordHeaderError
+		alertErr        tls.AlertError
+		unknownAuthErr  x509.UnknownAuthorityError
+		hostnameErr     x509.HostnameError
+		invalidErr      x509.CertificateInvalidError
+	)
+
+	return errors.As(err, &verificationErr) ||
+		errors.As(err, &recordHeaderErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
+
+func parseRetryTimeout() (time.Duration, error) {
+	retryTimeout := defaultRetryTimeout
+
+	retryTimeoutString := strings.TrimSpace(os.Getenv(retryTimeoutEnv))
+	if retryTimeoutString != "" {
+		var err error
+		retryTimeout, err = time.ParseDuration(retryTimeoutString)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse %q environment variable as a valid duration: %w", retryTimeoutEnv, err)
+		}
+		if retryTimeout < 0 {
+			return 0, fmt.Errorf("%q environment variable must not be negative", retryTimeoutEnv)
+		}
+	}
+
+	return retryTimeout, nil
+}
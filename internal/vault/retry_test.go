@@ -0,0 +1,261 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+func TestIsRetryable(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err      error
+		expected bool
+	}{
+		"500":              {&api.ResponseError{StatusCode: http.StatusInternalServerError}, true},
+		"503 wrapped":      {fmt.Errorf("failed to authenticate: %w", &api.ResponseError{StatusCode: http.StatusServiceUnavailable}), true},
+		"429":              {&api.ResponseError{StatusCode: http.StatusTooManyRequests}, true},
+		"400":              {&api.ResponseError{StatusCode: http.StatusBadRequest}, false},
+		"403":              {&api.ResponseError{StatusCode: http.StatusForbidden}, false},
+		"connection reset": {fmt.Errorf("Put: %w", syscall.ECONNRESET), true},
+		"connection refused": {&url.Error{Op: "Put", URL: "https://vault:8200", Err: &net.OpError{
+			Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+		}}, true},
+		"EOF":               {&url.Error{Op: "Put", URL: "https://vault:8200", Err: io.EOF}, true},
+		"unexpected EOF":    {fmt.Errorf("failed to read response: %w", io.ErrUnexpectedEOF), true},
+		"dial timeout":      {&url.Error{Op: "Put", URL: "https://vault:8200", Err: &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}}, true},
+		"unknown CA":        {&url.Error{Op: "Put", URL: "https://vault:8200", Err: x509.UnknownAuthorityError{}}, false},
+		"TLS to plain HTTP": {&url.Error{Op: "Put", URL: "https://vault:8200", Err: tls.RecordHeaderError{}}, false},
+		"invalid URL":       {&url.Error{Op: "parse", URL: "vault:8200", Err: errors.New("missing protocol scheme")}, false},
+		"canceled":          {&url.Error{Op: "Put", URL: "https://vault:8200", Err: context.Canceled}, false},
+		"STS throttling":    {fmt.Errorf("failed to assume role: %w", &smithy.GenericAPIError{Code: "Throttling"}), true},
+		"STS access denied": {&smithy.GenericAPIError{Code: "AccessDenied"}, false},
+		"other":             {errors.New("missing VAULT_AUTH_ROLE"), false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, isRetryable(tc.err))
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestParseRetryTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		timeout  string
+		expected time.Duration
+	}{
+		{"", defaultRetryTimeout},
+		{"0", 0},
+		{"500ms", 500 * time.Millisecond},
+		{"5s", 5 * time.Second},
+	} {
+		t.Setenv(retryTimeoutEnv, tc.timeout)
+		actual, err := parseRetryTimeout()
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, actual)
+	}
+
+	for _, timeout := range []string{"foo", "-1s"} {
+		t.Setenv(retryTimeoutEnv, timeout)
+		_, err := parseRetryTimeout()
+		require.Error(t, err)
+	}
+}
+
+func TestToken_Retries(t *testing.T) {
+	// statusVault fails with each status code in turn, then returns a token.
+	statusVault := func(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+		t.Helper()
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := int(atomic.AddInt32(&requests, 1))
+			if n <= len(statuses) {
+				http.Error(w, `{"errors":["unavailable"]}`, statuses[n-1])
+				return
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(lookupSelfResponse("token", 3600, true)))
+		}))
+		t.Cleanup(srv.Close)
+
+		return srv, &requests
+	}
+
+	newClient := func(t *testing.T, address string, retryTimeout time.Duration) *Client {
+		t.Helper()
+		vaultClient, err := api.NewClient(&api.Config{Address: address})
+		require.NoError(t, err)
+		vaultClient.ClearToken()
+		authConfig := config.AuthConfig{Method: config.AuthMethodToken, Token: "token"}
+		a, err := newTokenAuthenticator(hclog.NewNullLogger(), authConfig)
+		require.NoError(t, err)
+
+		return &Client{
+			VaultClient:   vaultClient,
+			logger:        hclog.NewNullLogger(),
+			authConfig:    authConfig,
+			authenticator: a,
+			retryTimeout:  retryTimeout,
+		}
+	}
+
+	t.Run("retries login on 5xx and 429", func(t *testing.T) {
+		srv, requests := statusVault(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway)
+		c := newClient(t, srv.URL, 10*time.Second)
+
+		token, err := c.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token", token)
+		require.Equal(t, int32(4), atomic.LoadInt32(requests))
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		srv, requests := statusVault(t, http.StatusForbidden)
+		c := newClient(t, srv.URL, 10*time.Second)
+
+		_, err := c.Token(context.Background())
+		require.Error(t, err)
+		require.Equal(t, int32(1), atomic.LoadInt32(requests))
+	})
+
+	t.Run("retries until Vault starts listening", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := l.Addr().String()
+		require.NoError(t, l.Close())
+		c := newClient(t, "http://"+addr, 10*time.Second)
+
+		var requests int32
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			require.NoError(t, json.NewEncoder(w).Encode(lookupSelfResponse("token", 3600, true)))
+		}))
+		t.Cleanup(srv.Close)
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				return
+			}
+			srv.Listener = l
+			srv.Start()
+		}()
+
+		token, err := c.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token", token)
+		require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("gives up after the retry timeout", func(t *testing.T) {
+		statuses := make([]int, 100)
+		for i := range statuses {
+			statuses[i] = http.StatusServiceUnavailable
+		}
+		srv, requests := statusVault(t, statuses...)
+		c := newClient(t, srv.URL, 300*time.Millisecond)
+
+		start := time.Now()
+		_, err := c.Token(context.Background())
+		require.Error(t, err)
+		require.Less(t, time.Since(start), time.Second)
+		require.Greater(t, atomic.LoadInt32(requests), int32(1))
+	})
+
+	t.Run("does not use the Vault client's own retries", func(t *testing.T) {
+		statuses := make([]int, 100)
+		for i := range statuses {
+			statuses[i] = http.StatusServiceUnavailable
+		}
+		srv, requests := statusVault(t, statuses...)
+		t.Setenv(retryTimeoutEnv, "500ms")
+		t.Setenv(tokenExpiryGracePeriodEnv, "")
+		// The default config retries 5xx responses twice, waiting at least
+		// a second between attempts.
+		vaultConfig := api.DefaultConfig()
+		require.NoError(t, vaultConfig.Error)
+		vaultConfig.Address = srv.URL
+		c, err := NewClient("", "", hclog.NewNullLogger(), vaultConfig, config.AuthConfig{
+			Method: config.AuthMethodToken,
+			Token:  "token",
+		}, aws.Config{})
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = c.Token(context.Background())
+		require.Error(t, err)
+		require.Less(t, time.Since(start), time.Second)
+		require.Greater(t, atomic.LoadInt32(requests), int32(1))
+
+		// Requests outside of login and renewal still use the client's retries.
+		atomic.StoreInt32(requests, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, err = c.VaultClient.Logical().ReadWithContext(ctx, "secret/foo")
+		require.Error(t, err)
+		require.Equal(t, int32(2), atomic.LoadInt32(requests))
+	})
+
+	t.Run("slow attempt is not cut short by the retry timeout", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(300 * time.Millisecond)
+			require.NoError(t, json.NewEncoder(w).Encode(lookupSelfResponse("token", 3600, true)))
+		}))
+		t.Cleanup(srv.Close)
+		c := newClient(t, srv.URL, 100*time.Millisecond)
+
+		token, err := c.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token", token)
+	})
+
+	t.Run("retries disabled", func(t *testing.T) {
+		srv, requests := statusVault(t, http.StatusServiceUnavailable)
+		c := newClient(t, srv.URL, 0)
+
+		_, err := c.Token(context.Background())
+		require.Error(t, err)
+		require.Equal(t, int32(1), atomic.LoadInt32(requests))
+	})
+
+	t.Run("retries renewal", func(t *testing.T) {
+		srv, requests := statusVault(t, http.StatusInternalServerError)
+		c := newClient(t, srv.URL, 10*time.Second)
+		c.VaultClient.SetToken("token")
+		c.tokenRenewable = true
+		c.tokenTTL = time.Hour
+		c.tokenExpiry = time.Now().Add(time.Minute)
+
+		_, err := c.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, int32(2), atomic.LoadInt32(requests))
+		require.True(t, c.tokenExpiry.After(time.Now().Add(30*time.Minute)))
+	})
+}
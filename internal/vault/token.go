@@ -0,0 +1,76 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+// tokenAuthenticator uses an existing token instead of logging in. "Logging
+// in" looks the token up to learn its TTL and whether it is renewable, after
+// which it is renewed like a token from any other auth method. A token file is
+// read again on every lookup, so it can be replaced once the token expires.
+type tokenAuthenticator struct {
+	logger     hclog.Logger
+	authConfig config.AuthConfig
+}
+
+func newTokenAuthenticator(logger hclog.Logger, authConfig config.AuthConfig) (*tokenAuthenticator, error) {
+	if authConfig.Token == "" && authConfig.TokenFile == "" {
+		return nil, errors.New("missing VAULT_TOKEN or VAULT_TOKEN_FILE environment variables")
+	}
+	logger.Warn("Using a static Vault token instead of logging in. This is intended for local development and break-glass access only; the token cannot be replaced when it expires unless it is read from VAULT_TOKEN_FILE")
+
+	return &tokenAuthenticator{
+		logger:     logger,
+		authConfig: authConfig,
+	}, nil
+}
+
+// Login looks up the configured token with auth/token/lookup-self.
+func (a *tokenAuthenticator) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	token, err := a.token()
+	if err != nil {
+		return nil, err
+	}
+
+	lookupClient, err := cloneWithToken(client, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client to look up token: %w", err)
+	}
+
+	secret, err := lookupClient.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up Vault token: %w", err)
+	}
+
+	return secret, nil
+}
+
+// token returns the token from the configured file, or from the environment.
+func (a *tokenAuthenticator) token() (string, error) {
+	if a.authConfig.TokenFile == "" {
+		return a.authConfig.Token, nil
+	}
+
+	b, err := os.ReadFile(a.authConfig.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file %q is empty", a.authConfig.TokenFile)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,107 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault-lambda-extension/internal/config"
+)
+
+func lookupSelfResponse(token string, ttl int, renewable bool) *api.Secret {
+	return &api.Secret{
+		Data: map[string]interface{}{
+			"id":        token,
+			"ttl":       ttl,
+			"renewable": renewable,
+		},
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	vault := fakeVault()
+	defer vault.Close()
+
+	newClient := func(t *testing.T, authConfig config.AuthConfig) *Client {
+		t.Helper()
+		vaultClient, err := api.NewClient(&api.Config{Address: vault.URL})
+		require.NoError(t, err)
+		vaultClient.ClearToken()
+		a, err := newTokenAuthenticator(hclog.NewNullLogger(), authConfig)
+		require.NoError(t, err)
+
+		return &Client{
+			VaultClient:   vaultClient,
+			logger:        hclog.NewNullLogger(),
+			authConfig:    authConfig,
+			authenticator: a,
+		}
+	}
+
+	t.Run("requires a token", func(t *testing.T) {
+		_, err := newTokenAuthenticator(hclog.NewNullLogger(), config.AuthConfig{Method: config.AuthMethodToken})
+		require.ErrorContains(t, err, "VAULT_TOKEN")
+	})
+
+	t.Run("looks up token from env", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		secretFunc = generateSecretFunc(t, []*api.Secret{lookupSelfResponse("env-token", 3600, true)})
+		c := newClient(t, config.AuthConfig{Method: config.AuthMethodToken, Token: "env-token"})
+
+		token, err := c.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "env-token", token)
+		require.Equal(t, 1, len(vaultRequests))
+		require.Equal(t, "/v1/auth/token/lookup-self", vaultRequests[0].URL.Path)
+		require.Equal(t, "env-token", vaultRequests[0].Header.Get("X-Vault-Token"))
+		require.Equal(t, time.Hour, c.tokenTTL)
+		require.True(t, c.tokenRenewable)
+	})
+
+	t.Run("token file takes precedence and is read on every lookup", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		secretFunc = generateSecretFunc(t, []*api.Secret{
+			lookupSelfResponse("file-token", 3600, false),
+			lookupSelfResponse("rotated-token", 3600, false),
+		})
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0600))
+		c := newClient(t, config.AuthConfig{Method: config.AuthMethodToken, Token: "env-token", TokenFile: tokenFile})
+
+		token, err := c.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "file-token", token)
+
+		require.NoError(t, os.WriteFile(tokenFile, []byte("rotated-token"), 0600))
+		c.RevokeToken()
+		token, err = c.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "rotated-token", token)
+		require.Equal(t, "rotated-token", vaultRequests[1].Header.Get("X-Vault-Token"))
+	})
+
+	t.Run("token without a TTL never expires", func(t *testing.T) {
+		vaultRequests = []*http.Request{}
+		secretFunc = generateSecretFunc(t, []*api.Secret{lookupSelfResponse("root-token", 0, false)})
+		c := newClient(t, config.AuthConfig{Method: config.AuthMethodToken, Token: "root-token"})
+
+		for i := 0; i < 3; i++ {
+			token, err := c.Token(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, "root-token", token)
+		}
+		require.Equal(t, 1, len(vaultRequests))
+		require.False(t, c.expired())
+		require.False(t, c.shouldRenew())
+	})
+}
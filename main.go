@@ -5,47 +5,93 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"path"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/api"
 
 	"github.com/hashicorp/vault-lambda-extension/internal/config"
+	"github.com/hashicorp/vault-lambda-extension/internal/execwrapper"
 	"github.com/hashicorp/vault-lambda-extension/internal/extension"
 	"github.com/hashicorp/vault-lambda-extension/internal/proxy"
 	"github.com/hashicorp/vault-lambda-extension/internal/runmode"
+	"github.com/hashicorp/vault-lambda-extension/internal/secretfile"
 	"github.com/hashicorp/vault-lambda-extension/internal/vault"
 )
 
+const (
+	// defaultShutdownTimeout bounds cleanup if a shutdown event has no deadline.
+	defaultShutdownTimeout = 500 * time.Millisecond
+
+	// shutdownDeadlineMargin is reserved for shutting down the proxy server
+	// after cleanup, and for exiting after revoking the token.
+	shutdownDeadlineMargin = 100 * time.Millisecond
+
+	// execWrapperCommand runs the binary as the Lambda runtime's exec wrapper
+	// instead of as an extension.
+	execWrapperCommand = "exec-wrapper"
+)
+
 func main() {
 	logger := hclog.New(&hclog.LoggerOptions{
 		Level: hclog.LevelFromString(os.Getenv(config.VaultLogLevel)),
 	})
 
-	logger.Info(fmt.Sprintf("Starting Vault Lambda Extension %v", config.ExtensionVersion))
-	runMode := runmode.ModeDefault
-	if runModeEnv := os.Getenv(config.VaultRunMode); runModeEnv != "" {
-		runMode = runmode.ParseMode(runModeEnv)
+	if len(os.Args) > 1 && os.Args[1] == execWrapperCommand {
+		if err := runExecWrapper(logger.Named("exec-wrapper"), os.Args[2:]); err != nil {
+			logger.Error("Fatal error in exec wrapper, exiting", "error", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	h := newHandler(logger.Named(config.ExtensionName), runMode)
+	logger.Info(fmt.Sprintf("Starting Vault Lambda Extension %v", config.ExtensionVersion))
+	h := newHandler(logger.Named(config.ExtensionName), runModeFromEnv())
 	if err := h.handle(); err != nil {
 		logger.Error("Fatal error, exiting", "error", err)
 		os.Exit(1)
 	}
 }
 
+// runExecWrapper sets environment variables from the secrets written to disk
+// by the extension in file mode, then replaces this process with the Lambda
+// runtime command given in args. It only returns on error.
+func runExecWrapper(logger hclog.Logger, args []string) error {
+	secrets, err := config.ParseConfiguredSecrets()
+	if err != nil {
+		return fmt.Errorf("failed to parse configured secrets: %w", err)
+	}
+	if err := execwrapper.CheckRunMode(runModeFromEnv(), secrets); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ExecWrapperConfigFromEnv().Timeout)
+	defer cancel()
+	env, err := execwrapper.Environ(ctx, logger, secrets, os.Environ())
+	if err != nil {
+		return err
+	}
+
+	return execwrapper.Exec(args, env)
+}
+
+func runModeFromEnv() runmode.Mode {
+	if runModeEnv := os.Getenv(config.VaultRunMode); runModeEnv != "" {
+		return runmode.ParseMode(runModeEnv)
+	}
+
+	return runmode.ModeDefault
+}
+
 func newHandler(logger hclog.Logger, runMode runmode.Mode) *handler {
 	return &handler{
 		logger:  logger,
@@ -56,6 +102,16 @@ func newHandler(logger hclog.Logger, runMode runmode.Mode) *handler {
 type handler struct {
 	logger  hclog.Logger
 	runMode runmode.Mode
+
+	// client is set once the extension has logged in to Vault.
+	client *vault.Client
+
+	// revokeTokenOnShutdown is set if the client's token should be revoked
+	// once the proxy server has shut down.
+	revokeTokenOnShutdown bool
+
+	// secretWriter is only set in file mode.
+	secretWriter *secretfile.Writer
 }
 
 func (h *handler) handle() error {
@@ -88,19 +144,22 @@ func (h *handler) handle() error {
 		}
 	}()
 
+	// Lambda starts the function's init once every extension has registered,
+	// so only register once secrets are written and the proxy is listening.
 	extensionClient := extension.NewClient(os.Getenv("AWS_LAMBDA_RUNTIME_API"))
 	_, err = extensionClient.Register(ctx, config.ExtensionName)
 	if err != nil {
 		return err
 	}
 
-	processEvents(ctx, h.logger, extensionClient)
+	res := h.processEvents(ctx, extensionClient)
 
 	// Once processEvents returns, signal that it's time to shutdown.
 	shutdownChannel <- struct{}{}
 
 	// Ensure we wait for the HTTP server to gracefully shut down.
 	wg.Wait()
+	h.revokeToken(res)
 	h.logger.Info("Graceful shutdown complete")
 
 	return nil
@@ -120,18 +179,24 @@ func (h *handler) runExtension(ctx context.Context, wg *sync.WaitGroup) (func(co
 		vaultConfig.Address = authConfig.VaultAddress
 	}
 
-	if vaultConfig.Address == "" || authConfig.Provider == "" || authConfig.Role == "" {
-		return nil, errors.New("missing VLE_VAULT_ADDR, VAULT_ADDR, VAULT_AUTH_PROVIDER or VAULT_AUTH_ROLE environment variables")
+	if vaultConfig.Address == "" {
+		return nil, errors.New("missing VLE_VAULT_ADDR or VAULT_ADDR environment variables")
 	}
 
-	awsLoadOptions := []func(*awsconfig.LoadOptions) error{}
-	if authConfig.STSEndpointRegion != "" {
-		awsLoadOptions = append(awsLoadOptions, awsconfig.WithRegion(authConfig.STSEndpointRegion))
-	}
+	// The AWS SDK config is only needed for AWS IAM auth, and loading it can
+	// fail outside of Lambda, e.g. when using a token for local development.
+	var awsCfg aws.Config
+	if authConfig.Method == config.AuthMethodAWS {
+		awsLoadOptions := []func(*awsconfig.LoadOptions) error{}
+		if authConfig.STSEndpointRegion != "" {
+			awsLoadOptions = append(awsLoadOptions, awsconfig.WithRegion(authConfig.STSEndpointRegion))
+		}
 
-	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsLoadOptions...)
-	if err != nil {
-		return nil, fmt.Errorf("error loading AWS SDK config: %w", err)
+		var err error
+		awsCfg, err = awsconfig.LoadDefaultConfig(ctx, awsLoadOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("error loading AWS SDK config: %w", err)
+		}
 	}
 
 	client, err := vault.NewClient(config.ExtensionName, config.ExtensionVersion, h.logger.Named("vault-client"), vaultConfig, authConfig, awsCfg)
@@ -148,6 +213,13 @@ func (h *handler) runExtension(ctx context.Context, wg *sync.WaitGroup) (func(co
 	if err != nil {
 		return nil, fmt.Errorf("error logging in to Vault: %w", err)
 	}
+	h.client = client
+	h.revokeTokenOnShutdown = authConfig.RevokeOnShutdown
+	if authConfig.RevokeOnShutdown && authConfig.Method == config.AuthMethodToken {
+		// The token wasn't created by the extension, and may be used elsewhere.
+		h.logger.Warn("VAULT_REVOKE_TOKEN_ON_SHUTDOWN is ignored with the token auth method")
+		h.revokeTokenOnShutdown = false
+	}
 
 	uaFunc := func(request *api.Request) string {
 		return config.GetUserAgentBase(config.ExtensionName, config.ExtensionVersion) + "; writing to temp file"
@@ -156,7 +228,12 @@ func (h *handler) runExtension(ctx context.Context, wg *sync.WaitGroup) (func(co
 	client.VaultClient = client.VaultClient.WithRequestCallbacks(api.RequireState(newState), vault.UserAgentRequestCallback(uaFunc)).WithResponseCallbacks()
 
 	if h.runMode.HasModeFile() {
-		if err := writePreconfiguredSecrets(h.logger, client.VaultClient); err != nil {
+		configuredSecrets, err := config.ParseConfiguredSecrets()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse configured secrets to read: %w", err)
+		}
+		h.secretWriter = secretfile.NewWriter(h.logger.Named("secret-file"), client, configuredSecrets, config.SecretFileConfigFromEnv())
+		if err := h.secretWriter.WriteAll(ctx); err != nil {
 			return nil, err
 		}
 	}
@@ -168,15 +245,19 @@ func (h *handler) runExtension(ctx context.Context, wg *sync.WaitGroup) (func(co
 	if h.runMode.HasModeProxy() {
 		start := time.Now()
 		h.logger.Debug("initialising proxy mode")
-		ln, err := net.Listen("tcp", "127.0.0.1:8200")
+		proxyConfig, err := config.ProxyConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		ln, err := proxy.Listen(proxyConfig)
 		if err != nil {
-			return nil, fmt.Errorf("failed to listen on port 8200: %w", err)
+			return nil, fmt.Errorf("failed to listen on %s: %w", proxyConfig.URL(), err)
 		}
-		srv := proxy.New(h.logger.Named("proxy"), client, config.CacheConfigFromEnv())
+		srv := proxy.New(h.logger.Named("proxy"), client, config.CacheConfigFromEnv(), proxyConfig)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			h.logger.Info("Starting HTTP proxy server")
+			h.logger.Info("Starting HTTP proxy server", "address", proxyConfig.URL())
 			err = srv.Serve(ln)
 			if err != http.ErrServerClosed {
 				h.logger.Error("HTTP server shutdown unexpectedly", "error", err)
@@ -192,65 +273,91 @@ func (h *handler) runExtension(ctx context.Context, wg *sync.WaitGroup) (func(co
 	return cleanupFunc, nil
 }
 
-// writePreconfiguredSecrets writes secrets to disk.
-func writePreconfiguredSecrets(logger hclog.Logger, client *api.Client) error {
-	start := time.Now()
-	logger.Debug("writing secrets to disk")
-	configuredSecrets, err := config.ParseConfiguredSecrets()
-	if err != nil {
-		return fmt.Errorf("failed to parse configured secrets to read: %w", err)
-	}
-
-	for _, s := range configuredSecrets {
-		// Will block until shutdown event is received or cancelled via the context.
-		secret, err := client.Logical().Read(s.VaultPath)
-		if err != nil {
-			return fmt.Errorf("error reading secret: %w", err)
-		}
-
-		content, err := json.MarshalIndent(secret, "", "  ")
-		if err != nil {
-			return fmt.Errorf("unable to marshal json: %w", err)
-		}
-
-		dir := path.Dir(s.FilePath)
-		if _, err = os.Stat(dir); os.IsNotExist(err) {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return fmt.Errorf("failed to create directory %q for secret %s: %s", dir, s.Name(), err)
-			}
-		}
-
-		if err := os.WriteFile(s.FilePath, content, 0644); err != nil {
-			return fmt.Errorf("error writing file: %w", err)
-		}
-	}
-
-	logger.Debug(fmt.Sprintf("wrote secrets to disk in %v", time.Since(start)))
-	return nil
-}
-
-// processEvents polls the Lambda Extension API for events. Currently all this
-// does is signal readiness to the Lambda platform after each event, which is
-// required in the Extension API.
+// processEvents polls the Lambda Extension API for events. On each invoke event,
+// the Vault token is refreshed in the background if it is due, so the function
+// doesn't wait for it on its first request to the proxy. Then any file-mode
+// secrets nearing the end of their lease are refreshed,
+// and on shutdown their files are removed and their leases revoked.
+// Polling for the next event signals readiness to the Lambda platform, which
+// is required in the Extension API.
 // The first call to NextEvent signals completion of the extension
-// init phase.
-func processEvents(ctx context.Context, logger hclog.Logger, extensionClient *extension.Client) {
+// init phase. It returns the shutdown event, or nil if it stopped for any other
+// reason.
+func (h *handler) processEvents(ctx context.Context, extensionClient *extension.Client) *extension.NextEventResponse {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		default:
-			logger.Info("Waiting for event...")
+			h.logger.Info("Waiting for event...")
 			res, err := extensionClient.NextEvent(ctx)
 			if err != nil {
-				logger.Error("Error receiving event", "error", err)
-				return
+				h.logger.Error("Error receiving event", "error", err)
+				return nil
 			}
-			logger.Info("Received event")
+			h.logger.Info("Received event")
 			// Exit if we receive a SHUTDOWN event
 			if res.EventType == extension.Shutdown {
-				return
+				h.shutdown(res)
+				return res
+			}
+
+			if h.client != nil {
+				h.client.RefreshToken(ctx)
+			}
+			if h.secretWriter != nil {
+				if err := h.secretWriter.Refresh(ctx); err != nil {
+					h.logger.Error("Failed to refresh secrets, will retry on next invoke", "error", err)
+				}
 			}
 		}
 	}
 }
+
+// shutdown does best-effort cleanup of file-mode secrets before the deadline
+// given in the shutdown event.
+func (h *handler) shutdown(res *extension.NextEventResponse) {
+	if h.secretWriter == nil {
+		return
+	}
+
+	// The parent context may already be cancelled by a signal, so only the
+	// deadline applies to cleanup.
+	ctx, cancel := shutdownContext(res)
+	defer cancel()
+	// Removing files is local and fast, so it happens first in case revoking
+	// leases uses up the deadline.
+	h.secretWriter.RemoveFiles()
+	h.secretWriter.RevokeLeases(ctx)
+}
+
+// revokeToken revokes the extension's Vault token if configured to. It runs
+// once the proxy server has shut down, so no requests are still using the
+// token, and it is bounded by the shutdown deadline so a Vault outage can't
+// block shutdown.
+func (h *handler) revokeToken(res *extension.NextEventResponse) {
+	if h.client == nil || !h.revokeTokenOnShutdown {
+		return
+	}
+
+	ctx, cancel := shutdownContext(res)
+	defer cancel()
+	start := time.Now()
+	if err := h.client.RevokeSelf(ctx); err != nil {
+		h.logger.Error("Failed to revoke Vault token", "error", err)
+		return
+	}
+	h.logger.Info(fmt.Sprintf("Revoked Vault token in %v", time.Since(start)))
+}
+
+// shutdownContext returns a context that expires shortly before the deadline
+// given in the shutdown event, leaving time for the rest of the shutdown. If
+// there is no shutdown event, a default timeout is used.
+func shutdownContext(res *extension.NextEventResponse) (context.Context, context.CancelFunc) {
+	if res == nil || res.DeadlineMs <= 0 {
+		return context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	}
+	deadline := time.UnixMilli(res.DeadlineMs).Add(-shutdownDeadlineMargin)
+
+	return context.WithDeadline(context.Background(), deadline)
+}